@@ -0,0 +1,216 @@
+// Reading whitespace aligned output of command line tools.
+
+package vxsv
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Number of lines after the header used to work out where columns start
+const AlignedSampleLines = 100
+
+// Width that tabs are expanded to before lining up columns
+const AlignedTabWidth = 8
+
+// Parses the space aligned tables printed by tools like docker, kubectl, df
+// and ps:
+//
+// CONTAINER ID   IMAGE   COMMAND                  STATUS
+// 0a1b2c3d4e5f   nginx   "/docker-entrypoint.…"   Up 2 hours
+//
+// Columns start at the words of the header. Neighbouring words only start
+// separate columns when the rows have a gap between them too, so headers
+// such as "CONTAINER ID" stay together. The last column runs to the end of
+// each line, spaces and all.
+func ReadAlignedTable(reader io.Reader, count int64) (*TabularData, error) {
+	data, err := StreamAlignedTable(reader, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
+
+// Like ReadAlignedTable, but loads rows into data.Store in the background.
+func StreamAlignedTable(reader io.Reader, count int64) (*TabularData, error) {
+	scanner := bufio.NewScanner(reader)
+
+	var header []rune
+	for len(header) == 0 && scanner.Scan() {
+		header = expandTabs(strings.TrimRight(scanner.Text(), " \t\r"))
+	}
+
+	// Read ahead to see where the rows have gaps
+	var sample [][]rune
+	for len(sample) < AlignedSampleLines && scanner.Scan() {
+		if line := alignedLine(scanner.Text()); len(line) > 0 {
+			sample = append(sample, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	starts := alignedColumnStarts(header, sample)
+
+	columns := make([]Column, len(starts))
+	for i := range columns {
+		name := string(sliceColumn(header, starts, i))
+		columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	next := func() ([]string, error) {
+		var line []rune
+
+		if len(sample) > 0 {
+			line, sample = sample[0], sample[1:]
+		} else {
+			for len(line) == 0 {
+				if !scanner.Scan() {
+					return nil, scannerDone(scanner)
+				}
+
+				line = alignedLine(scanner.Text())
+			}
+		}
+
+		row := make([]string, len(starts))
+		for i := range row {
+			row[i] = string(sliceColumn(line, starts, i))
+		}
+
+		return row, nil
+	}
+
+	return &TabularData{
+		Columns: columns,
+		Store:   streamRows(next, count),
+	}, nil
+}
+
+// A line of input ready to be sliced into columns, or empty if it's blank.
+func alignedLine(line string) []rune {
+	return expandTabs(strings.TrimRight(line, " \t\r"))
+}
+
+func expandTabs(line string) []rune {
+	if !strings.ContainsRune(line, '\t') {
+		return []rune(line)
+	}
+
+	var expanded []rune
+	for _, r := range line {
+		if r == '\t' {
+			for pad := AlignedTabWidth - len(expanded)%AlignedTabWidth; pad > 0; pad-- {
+				expanded = append(expanded, ' ')
+			}
+		} else {
+			expanded = append(expanded, r)
+		}
+	}
+
+	return expanded
+}
+
+// Trimmed contents of column idx, the last of which runs to the end of line.
+func sliceColumn(line []rune, starts []int, idx int) []rune {
+	start := min(starts[idx], len(line))
+
+	end := len(line)
+	if idx+1 < len(starts) {
+		end = min(starts[idx+1], len(line))
+	}
+
+	cell := line[start:end]
+	for len(cell) > 0 && cell[0] == ' ' {
+		cell = cell[1:]
+	}
+
+	for len(cell) > 0 && cell[len(cell)-1] == ' ' {
+		cell = cell[:len(cell)-1]
+	}
+
+	return cell
+}
+
+// Where each column starts. Every word of the header is a candidate, which
+// is kept only if the rows have a gap somewhere between it and the previous
+// word, and something in the column it would start. Right aligned values
+// can stick out to the left of their header, so columns start just after
+// the last gap rather than at the word itself.
+func alignedColumnStarts(header []rune, sample [][]rune) []int {
+	isBlank := func(line []rune, pos int) bool {
+		return pos >= len(line) || line[pos] == ' '
+	}
+
+	// Positions which are blank in every row
+	gaps := func(pos int) bool {
+		for _, line := range sample {
+			if !isBlank(line, pos) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// Start and end of each word in the header
+	var words [][2]int
+	for pos := 0; pos < len(header); pos++ {
+		if header[pos] == ' ' {
+			continue
+		}
+
+		start := pos
+		for pos < len(header) && header[pos] != ' ' {
+			pos++
+		}
+
+		words = append(words, [2]int{start, pos})
+	}
+
+	starts := []int{0}
+
+	for i := 1; i < len(words); i++ {
+		start := -1
+		for pos := words[i][0] - 1; pos >= words[i-1][1]; pos-- {
+			if gaps(pos) {
+				start = pos + 1
+				break
+			}
+		}
+
+		if start != -1 {
+			starts = append(starts, start)
+		}
+	}
+
+	// Drop columns which none of the rows have anything in, such as the
+	// "on" of "Mounted on"
+	kept := starts[:1]
+	for i := 1; i < len(starts); i++ {
+		end := -1
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		empty := true
+		for _, line := range sample {
+			for pos := starts[i]; pos < len(line) && (end == -1 || pos < end); pos++ {
+				if !isBlank(line, pos) {
+					empty = false
+					break
+				}
+			}
+		}
+
+		if !empty || len(sample) == 0 {
+			kept = append(kept, starts[i])
+		}
+	}
+
+	return kept
+}
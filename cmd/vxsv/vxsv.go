@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"database/sql"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/docopt/docopt-go"
 	"github.com/erik/vxsv"
@@ -15,8 +18,14 @@ func main() {
 	usage := fmt.Sprintf(`view [x] separated values
 
 Usage:
-  vxsv [--psql | --mysql | --delimiter=DELIM | --tabs]
-       [--no-headers] [--count=N] [PATH | -]
+  vxsv [--psql | --mysql | --grid | --html | --json | --logfmt |
+        --access-log | --columns | --widths=SPEC | --delimiter=DELIM |
+        --tabs]
+       [--no-headers] [--count=N] [--index | --follow]
+       [--encoding=ENC] [--quote=CHAR] [--escape=CHAR]
+       [--comment=CHAR] [--lazy-quotes] [--trim-space] [--skip=N]
+       [--lenient] [--json-path=PATH] [--query=SQL] [--null=STR]
+       [PATH | -]
   vxsv -h | --help
 
 Arguments:
@@ -26,29 +35,120 @@ Options:
   -h --help                 show this help message and exit.
   -p --psql                 parse output of psql cli (used as a pager)
   -m --mysql                parse output of mysql cli
+  -g --grid                 parse tables drawn with borders: Markdown,
+                            org-mode, ASCII grid or box drawing tables.
+  --html                    read the <table>s of an HTML page, picking one
+                            from a list if there are several.
+  -j --json                 parse JSON lines, one object per line, or a JSON
+                            document holding an array of objects. Nested
+                            objects are flattened into dotted column names.
+  --columns                 parse space aligned output of tools like docker,
+                            kubectl, df and ps, split where the header's
+                            words start.
+  -w --widths=SPEC          read fixed width records, given either a comma
+                            separated list of field widths (e.g. 10,8,20),
+                            or a file with a name, start column (from 1) and
+                            length for each field on its own line.
+  --json-path=PATH          where the array of records is in a JSON document,
+                            e.g. data.items. Implies --json.
+  --logfmt                  parse logfmt lines of key=value pairs, with a
+                            column for every key.
+  --access-log              parse Apache or nginx access logs in the combined
+                            or common log format.
+  --query=SQL               query to run against a SQLite database, instead of
+                            picking one of its tables. Press Q to edit it.
+  --null=STR                what psql shows for null values, as set with
+                            \pset null, so they can be told apart.
   -n --count=N              only read N records.
   -H --no-headers           don't read headers from first row (for separated values)
-  -d --delimiter=DELIM      separator for values [default: ,].
+  -d --delimiter=DELIM      separator for values, either a single character or
+                            one of comma, tab, semicolon, pipe, space.
+                            Guessed from the input if not given.
   -t --tabs                 use tabs as separator value.
+  -q --quote=CHAR           quote character for values, guessed if not given.
+  --escape=CHAR             character escaping the next one inside values
+                            (e.g. \), instead of doubling quotes.
+  -c --comment=CHAR         skip lines starting with CHAR.
+  --lazy-quotes             allow unescaped quotes inside values.
+  --trim-space              ignore spaces at the start of values.
+  --skip=N                  skip N lines of preamble before the header
+                            (for separated values and fixed widths).
+  -l --lenient              load malformed rows as best we can instead of
+                            stopping at the first one. Press E to list them.
+  -i --index                only index PATH and read rows on demand, for
+                            files too large to fit in memory.
+  -e --encoding=ENC         character encoding of the input, e.g. latin1,
+                            windows-1252, utf-16le [default: guess].
+  -f --follow               keep reading new rows as they are appended to
+                            the input, like "tail -f".
+
+The input format is guessed when none of --psql, --mysql, --grid, --html,
+--json, --json-path, --logfmt, --access-log, --columns, --widths,
+--delimiter or --tabs are given.
 `)
 
 	args, _ := docopt.Parse(usage, nil, true, "0.0.0", false)
 
 	var count int64 = math.MaxInt64
-	var data *vxsv.TabularData
 	var err error
 
-	// default to stdin if we don't have an explicit file passed in
-	reader := io.Reader(os.Stdin)
+	fileName, hasFile := args["PATH"].(string)
+	hasFile = hasFile && fileName != "-"
+	follow := args["--follow"] == true
 
-	if fileName, ok := args["PATH"].(string); ok && fileName != "-" {
-		file, err := os.Open(fileName)
-		if err != nil {
-			fmt.Printf("Failed to open \"%s\": %v", fileName, err)
+	csvOpts := vxsv.CSVOptions{
+		LazyQuotes:       args["--lazy-quotes"] == true,
+		TrimLeadingSpace: args["--trim-space"] == true,
+		Lenient:          args["--lenient"] == true,
+	}
+
+	if args["--tabs"] == true {
+		csvOpts.Delimiter = '\t'
+	} else if delimStr, ok := args["--delimiter"].(string); ok {
+		if csvOpts.Delimiter, err = parseDelimiter(delimStr); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	for flag, char := range map[string]*rune{
+		"--quote":   &csvOpts.Quote,
+		"--escape":  &csvOpts.Escape,
+		"--comment": &csvOpts.Comment,
+	} {
+		if str, ok := args[flag].(string); ok {
+			if *char, err = parseChar(flag, str); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if skipStr, ok := args["--skip"].(string); ok {
+		if csvOpts.SkipLines, err = strconv.Atoi(skipStr); err != nil || csvOpts.SkipLines < 0 {
+			fmt.Printf("Invalid value given for skip: %s\n", skipStr)
 			os.Exit(1)
 		}
+	}
+
+	jsonPath, _ := args["--json-path"].(string)
+	query, _ := args["--query"].(string)
+	null, _ := args["--null"].(string)
 
-		reader = io.Reader(file)
+	var widths []vxsv.FixedWidthField
+	if spec, ok := args["--widths"].(string); ok {
+		if widths, err = parseWidths(spec); err != nil {
+			fmt.Printf("Invalid value given for widths: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Kept for running queries typed in later, and replaced on reload
+	var database *sql.DB
+
+	encodingName := ""
+	if enc, ok := args["--encoding"].(string); ok && enc != "guess" {
+		encodingName = enc
 	}
 
 	if countStr, ok := args["--count"].(string); ok {
@@ -58,37 +158,316 @@ Options:
 		}
 	}
 
-	if args["--psql"] == true {
-		if data, err = vxsv.ReadPSQLTable(reader, count); err != nil {
-			fmt.Printf("Failed to read PSQL data: %v", err)
-			os.Exit(1)
+	// Open and parse the input according to the command line flags. This
+	// is run again each time the file is reloaded.
+	load := func() (data *vxsv.TabularData, err error) {
+		// default to stdin if we don't have an explicit file passed in
+		reader := io.Reader(os.Stdin)
+		var file *os.File
+		var db *sql.DB
+
+		if hasFile {
+			if file, err = os.Open(fileName); err != nil {
+				return nil, fmt.Errorf("Failed to open \"%s\": %v", fileName, err)
+			}
+
+			// Kept open for rows which are read on demand, or still loading
+			defer func() {
+				if err != nil {
+					file.Close()
+				}
+			}()
+
+			reader = io.Reader(file)
 		}
-	} else if args["--mysql"] == true {
-		if data, err = vxsv.ReadMySQLTable(reader, count); err != nil {
-			fmt.Printf("Failed to read MySQL data: %v", err)
-			os.Exit(1)
+
+		if follow {
+			reader = vxsv.NewFollowReader(reader)
 		}
-	} else {
-		delimiter := ','
-		if args["--tabs"] == true {
-			delimiter = '\t'
-		} else if delimStr, ok := args["--delimiter"].(string); ok {
-			delimiter = []rune(delimStr)[0]
+
+		reader, compression, err := vxsv.Decompress(reader)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress input: %v", err)
 		}
 
-		readHeaders := args["--no-headers"] == false
+		// Binary formats have to be spotted before trying to decode them as
+		// text, and take precedence over any flags
+		reader, binaryFormat, err := vxsv.SniffBinaryFormat(reader)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read input: %v", err)
+		}
 
-		if data, err = vxsv.ReadCSVFile(reader, delimiter, readHeaders, count); err != nil {
-			fmt.Printf("Failed to read CSV file (do you have the right delimiter?): %v\n", err)
-			os.Exit(1)
+		encoding := "binary"
+		if binaryFormat == "" {
+			if reader, encoding, err = vxsv.Decode(reader, encodingName); err != nil {
+				return nil, fmt.Errorf("Failed to decode input: %v", err)
+			}
+		}
+
+		// Explicit flags win over guessing
+		input := vxsv.InputFormat{Format: vxsv.FormatCSV, CSV: csvOpts}
+		switch {
+		case binaryFormat != "":
+			input.Format = binaryFormat
+		case args["--psql"] == true:
+			input.Format = vxsv.FormatPSQL
+		case args["--mysql"] == true:
+			input.Format = vxsv.FormatMySQL
+		case args["--grid"] == true:
+			input.Format = vxsv.FormatGrid
+		case args["--html"] == true:
+			input.Format = vxsv.FormatHTML
+		case args["--json"] == true || jsonPath != "":
+			input.Format = vxsv.FormatJSON
+		case args["--logfmt"] == true:
+			input.Format = vxsv.FormatLogfmt
+		case args["--access-log"] == true:
+			input.Format = vxsv.FormatAccessLog
+		case args["--columns"] == true:
+			input.Format = vxsv.FormatAligned
+		case widths != nil:
+			input.Format = vxsv.FormatFixedWidth
+		case csvOpts.Delimiter != 0 && csvOpts.Quote != 0:
+		default:
+			if reader, input, err = vxsv.SniffFormat(reader, csvOpts); err != nil {
+				return nil, fmt.Errorf("Failed to read input: %v", err)
+			}
+		}
+
+		if query != "" && input.Format != vxsv.FormatSQLite {
+			return nil, fmt.Errorf("--query can only be used with SQLite databases")
+		} else if null != "" && input.Format != vxsv.FormatPSQL {
+			return nil, fmt.Errorf("--null can only be used with psql output")
 		}
+
+		format := input.Format
+
+		switch input.Format {
+		case vxsv.FormatPSQL:
+			if data, err = vxsv.StreamPSQLTableWithOptions(reader, vxsv.PSQLOptions{Null: null}, count); err != nil {
+				return nil, fmt.Errorf("Failed to read PSQL data: %v", err)
+			}
+		case vxsv.FormatMySQL:
+			if data, err = vxsv.StreamMySQLTable(reader, count); err != nil {
+				return nil, fmt.Errorf("Failed to read MySQL data: %v", err)
+			}
+		case vxsv.FormatGrid:
+			if data, err = vxsv.StreamGridTable(reader, count); err != nil {
+				return nil, fmt.Errorf("Failed to read table: %v", err)
+			}
+		case vxsv.FormatHTML:
+			if data, err = vxsv.ReadHTMLTables(reader, count); err != nil {
+				return nil, fmt.Errorf("Failed to read HTML tables: %v", err)
+			}
+		case vxsv.FormatLogfmt:
+			if data, err = vxsv.StreamLogfmt(reader, csvOpts.Lenient, count); err != nil {
+				return nil, fmt.Errorf("Failed to read logfmt: %v", err)
+			}
+		case vxsv.FormatAccessLog:
+			if data, err = vxsv.StreamAccessLog(reader, csvOpts.Lenient, count); err != nil {
+				return nil, fmt.Errorf("Failed to read access log: %v", err)
+			}
+		case vxsv.FormatAligned:
+			if data, err = vxsv.StreamAlignedTable(reader, count); err != nil {
+				return nil, fmt.Errorf("Failed to read aligned columns: %v", err)
+			}
+		case vxsv.FormatFixedWidth:
+			// Fields named by a spec file leave no header to read
+			readHeaders := args["--no-headers"] == false && widths[0].Name == ""
+
+			if data, err = vxsv.StreamFixedWidthFile(reader, widths, readHeaders, csvOpts.SkipLines, count); err != nil {
+				return nil, fmt.Errorf("Failed to read fixed width records: %v", err)
+			}
+		case vxsv.FormatJSON:
+			if data, err = vxsv.StreamJSON(reader, jsonPath, csvOpts.Lenient, count); err != nil {
+				return nil, fmt.Errorf("Failed to read JSON data: %v", err)
+			}
+
+			format = data.Source.Format
+		case vxsv.FormatSpreadsheet:
+			if follow {
+				return nil, fmt.Errorf("--follow can't be used with spreadsheets")
+			}
+
+			if data, err = vxsv.ReadSpreadsheet(reader, args["--no-headers"] == false, count); err != nil {
+				return nil, fmt.Errorf("Failed to read spreadsheet: %v", err)
+			}
+
+			format = data.Source.Format
+		case vxsv.FormatParquet, vxsv.FormatArrow:
+			if follow {
+				return nil, fmt.Errorf("--follow can't be used with %s files", input.Format)
+			}
+
+			// Rows are read from all over the file as they're needed
+			var columnar vxsv.ReadAtSeeker = file
+			if file == nil || compression != "" {
+				content, err := io.ReadAll(reader)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to read input: %v", err)
+				}
+
+				columnar = bytes.NewReader(content)
+			}
+
+			if input.Format == vxsv.FormatParquet {
+				data, err = vxsv.OpenParquetFile(columnar, count)
+			} else {
+				data, err = vxsv.OpenArrowFile(columnar, count)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read %s file: %v", input.Format, err)
+			}
+		case vxsv.FormatSQLite:
+			if file == nil || compression != "" {
+				return nil, fmt.Errorf("SQLite databases can only be read from an uncompressed PATH")
+			} else if follow {
+				return nil, fmt.Errorf("--follow can't be used with SQLite databases")
+			}
+
+			if db, err = vxsv.OpenSQLite(fileName); err != nil {
+				return nil, fmt.Errorf("Failed to open SQLite database: %v", err)
+			}
+
+			if query != "" {
+				data, err = vxsv.StreamSQLQuery(db, query, count)
+			} else {
+				data, err = vxsv.ReadSQLiteTables(db, count)
+			}
+
+			if err != nil {
+				db.Close()
+				return nil, fmt.Errorf("Failed to read SQLite database: %v", err)
+			}
+
+			database = db
+		default:
+			opts := input.CSV
+			readHeaders := args["--no-headers"] == false
+			format = fmt.Sprintf("csv (delimiter %q)", opts.Delimiter)
+
+			if args["--index"] == true {
+				if file == nil {
+					return nil, fmt.Errorf("--index requires a PATH to read from")
+				} else if compression != "" {
+					return nil, fmt.Errorf("--index can't be used with %s compressed files", compression)
+				} else if !strings.HasPrefix(encoding, "utf-8") {
+					return nil, fmt.Errorf("--index only supports UTF-8 files, not %s", encoding)
+				}
+
+				data, err = vxsv.IndexCSVFile(file, opts, readHeaders, count)
+			} else {
+				data, err = vxsv.StreamCSVFile(reader, opts, readHeaders, count)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read CSV file (do you have the right delimiter?): %v", err)
+			}
+		}
+
+		data.Name = fileName
+		data.Source = vxsv.SourceInfo{
+			Path:        fileName,
+			Format:      format,
+			Compression: compression,
+			Encoding:    encoding,
+		}
+		data.Follow = follow
+
+		// Stop loading or following the old copy once it has been reloaded
+		data.Close = func() {
+			if db != nil {
+				db.Close()
+			}
+
+			if file != nil {
+				file.Close()
+			}
+		}
+
+		return data, nil
+	}
+
+	data, err := load()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
 	ui := vxsv.NewUI(data)
+
+	// stdin can't be read twice, and a followed file is expected to change.
+	// Databases are often written to while they're being looked at, so
+	// they're only reloaded when asked.
+	if hasFile && (follow || database != nil) {
+		ui.EnableReload("", load)
+	} else if hasFile {
+		ui.EnableReload(fileName, load)
+	}
+
+	if database != nil {
+		ui.EnableQuery(func(query string) (*vxsv.TabularData, error) {
+			return vxsv.StreamSQLQuery(database, query, count)
+		})
+	}
+
 	if err := ui.Init(); err != nil {
 		fmt.Printf("Failed to initialize terminal UI: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Let the user choose which table of a database or page to look at first
+	pick := (database != nil && query == "") || data.Source.Format == vxsv.FormatHTML
+	if pick && len(data.Tables) > 1 {
+		ui.PickTable()
+	}
+
 	ui.Loop()
 }
+
+// Field widths are either listed, or read from a file naming each field.
+func parseWidths(spec string) ([]vxsv.FixedWidthField, error) {
+	if fields, err := vxsv.ParseFixedWidths(spec); err == nil {
+		return fields, nil
+	}
+
+	file, err := os.Open(spec)
+	if err != nil {
+		return nil, fmt.Errorf("\"%s\" is neither a list of widths nor a readable file", spec)
+	}
+	defer file.Close()
+
+	fields, err := vxsv.ReadFixedWidthSpec(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", spec, err)
+	}
+
+	return fields, nil
+}
+
+var delimiterNames = map[string]rune{
+	"comma":     ',',
+	"tab":       '\t',
+	"\\t":       '\t',
+	"semicolon": ';',
+	"pipe":      '|',
+	"space":     ' ',
+}
+
+// Accept either a single character, or the name of a common delimiter.
+func parseDelimiter(str string) (rune, error) {
+	if delimiter, ok := delimiterNames[strings.ToLower(str)]; ok {
+		return delimiter, nil
+	}
+
+	return parseChar("--delimiter", str)
+}
+
+func parseChar(flag, str string) (rune, error) {
+	if runes := []rune(str); len(runes) == 1 {
+		return runes[0], nil
+	}
+
+	return 0, fmt.Errorf("Invalid value given for %s \"%s\": expected a single character", flag, str)
+}
@@ -0,0 +1,292 @@
+// Reading columnar Parquet and Arrow IPC files.
+
+package vxsv
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// Shown for null values in Parquet and Arrow files
+const ColumnarNull = "null"
+
+// Number of decoded row groups or record batches a ChunkedStore keeps around
+const ChunkCacheSize = 4
+
+// Files we can read from anywhere, such as an *os.File or *bytes.Reader
+type ReadAtSeeker interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+// ChunkedStore holds a table split into chunks, such as the row groups of a
+// Parquet file, which are only decoded once one of their rows is needed.
+type ChunkedStore struct {
+	loadState
+
+	// Where each chunk starts, plus where the last one ends
+	starts []int
+	limit  int
+	widths []int
+
+	// Guards decode and cache, which are only used from the UI's goroutine
+	// but may race with a loader that's still finding the chunks
+	decodeMu sync.Mutex
+	decode   func(chunk int) ([][]string, error)
+	cache    []decodedChunk
+}
+
+type decodedChunk struct {
+	idx  int
+	rows [][]string
+}
+
+func newChunkedStore(numColumns int, limit int64, decode func(int) ([][]string, error)) *ChunkedStore {
+	return &ChunkedStore{
+		loadState: newLoadState(true),
+		starts:    []int{0},
+		limit:     int(min(limit, math.MaxInt)),
+		widths:    make([]int, numColumns),
+		decode:    decode,
+	}
+}
+
+// Record that the next chunk holds n rows
+func (s *ChunkedStore) addChunk(n int) {
+	s.mu.Lock()
+	s.starts = append(s.starts, s.starts[len(s.starts)-1]+n)
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+func (s *ChunkedStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return min(s.starts[len(s.starts)-1], s.limit)
+}
+
+func (s *ChunkedStore) ColumnWidths() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]int(nil), s.widths...)
+}
+
+func (s *ChunkedStore) Row(idx int) []string {
+	s.mu.RLock()
+	chunk := sort.SearchInts(s.starts, idx+1) - 1
+	offset := idx - s.starts[chunk]
+	s.mu.RUnlock()
+
+	rows := s.chunk(chunk)
+	if offset >= len(rows) {
+		return nil
+	}
+
+	return rows[offset]
+}
+
+// Decoded rows of a chunk, from the cache if possible
+func (s *ChunkedStore) chunk(idx int) [][]string {
+	s.decodeMu.Lock()
+	defer s.decodeMu.Unlock()
+
+	for i, cached := range s.cache {
+		if cached.idx == idx {
+			// Move to the front
+			copy(s.cache[1:i+1], s.cache[:i])
+			s.cache[0] = cached
+			return cached.rows
+		}
+	}
+
+	rows, err := s.decode(idx)
+	if err != nil {
+		// Don't bring down the UI, but make it obvious something is wrong
+		rows = [][]string{{"<error: " + err.Error() + ">"}}
+	}
+
+	s.mu.Lock()
+	for _, row := range rows {
+		for i, cell := range row {
+			if i < len(s.widths) && displayWidth(cell) > s.widths[i] {
+				s.widths[i] = displayWidth(cell)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if len(s.cache) == ChunkCacheSize {
+		s.cache = s.cache[:ChunkCacheSize-1]
+	}
+
+	s.cache = append([]decodedChunk{{idx, rows}}, s.cache...)
+	return rows
+}
+
+// Start a table whose columns come from an Arrow schema
+func schemaTable(schema *arrow.Schema, store *ChunkedStore) *TabularData {
+	data := &TabularData{Null: ColumnarNull, Store: store}
+
+	for _, field := range schema.Fields() {
+		data.Columns = append(data.Columns, Column{Name: field.Name, Width: displayWidth(field.Name)})
+	}
+
+	return data
+}
+
+// OpenParquetFile reads a Parquet file's schema and row group sizes. Row
+// groups are only decoded once their rows are needed, so large files open
+// quickly.
+func OpenParquetFile(reader ReadAtSeeker, count int64) (*TabularData, error) {
+	parquetReader, err := file.NewParquetReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := memory.NewGoAllocator()
+	fileReader, err := pqarrow.NewFileReader(parquetReader, pqarrow.ArrowReadProperties{}, mem)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := fileReader.Schema()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every leaf column, nested ones included
+	leaves := make([]int, parquetReader.MetaData().Schema.NumColumns())
+	for i := range leaves {
+		leaves[i] = i
+	}
+
+	decode := func(rowGroup int) ([][]string, error) {
+		table, err := fileReader.ReadRowGroups(context.Background(), leaves, []int{rowGroup})
+		if err != nil {
+			return nil, err
+		}
+		defer table.Release()
+
+		return tableRows(table), nil
+	}
+
+	store := newChunkedStore(len(schema.Fields()), count, decode)
+	for i := 0; i < parquetReader.NumRowGroups(); i++ {
+		store.addChunk(int(parquetReader.MetaData().RowGroup(i).NumRows()))
+	}
+
+	store.finish(nil)
+
+	// Give the columns a head start on their widths
+	if store.Len() > 0 {
+		store.chunk(0)
+	}
+
+	return schemaTable(schema, store), nil
+}
+
+// OpenArrowFile reads the schema of an Arrow IPC (or Feather v2) file. The
+// size of each record batch is found in the background, and batches are
+// only kept decoded while their rows are needed.
+func OpenArrowFile(reader ReadAtSeeker, count int64) (*TabularData, error) {
+	fileReader, err := ipc.NewFileReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reader isn't safe for concurrent use
+	var mu sync.Mutex
+
+	readBatch := func(idx int) (arrow.RecordBatch, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return fileReader.RecordBatchAt(idx)
+	}
+
+	decode := func(idx int) ([][]string, error) {
+		batch, err := readBatch(idx)
+		if err != nil {
+			return nil, err
+		}
+		defer batch.Release()
+
+		return recordRows(batch), nil
+	}
+
+	store := newChunkedStore(len(fileReader.Schema().Fields()), count, decode)
+
+	go func() {
+		for i := 0; i < fileReader.NumRecords() && int64(store.Len()) < count; i++ {
+			batch, err := readBatch(i)
+			if err != nil {
+				store.finish(err)
+				return
+			}
+
+			store.addChunk(int(batch.NumRows()))
+			batch.Release()
+
+			// Give the columns a head start on their widths
+			if i == 0 {
+				store.chunk(0)
+			}
+		}
+
+		store.finish(nil)
+	}()
+
+	return schemaTable(fileReader.Schema(), store), nil
+}
+
+func tableRows(table arrow.Table) [][]string {
+	var rows [][]string
+
+	reader := array.NewTableReader(table, -1)
+	defer reader.Release()
+
+	for reader.Next() {
+		rows = append(rows, recordRows(reader.RecordBatch())...)
+	}
+
+	return rows
+}
+
+func recordRows(batch arrow.RecordBatch) [][]string {
+	rows := make([][]string, batch.NumRows())
+	for i := range rows {
+		rows[i] = make([]string, batch.NumCols())
+	}
+
+	for j, column := range batch.Columns() {
+		for i := range rows {
+			rows[i][j] = arrowValue(column, i)
+		}
+	}
+
+	return rows
+}
+
+// Display form of a value. Arrow already knows how to show timestamps,
+// decimals, lists and the like readably.
+func arrowValue(column arrow.Array, idx int) string {
+	if column.IsNull(idx) {
+		return ColumnarNull
+	}
+
+	return column.ValueStr(idx)
+}
@@ -1,26 +1,79 @@
 package vxsv
 
 import (
-	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
-func ReadCSVFile(reader io.Reader, delimiter rune, readHeader bool, count int64) (*TabularData, error) {
-	csv := csv.NewReader(reader)
+// CSVOptions describes the dialect of a delimited file. The zero value means
+// plain comma separated values.
+type CSVOptions struct {
+	Delimiter rune
+	Quote     rune
 
-	data := &TabularData{
-		Rows: make([][]string, 0, 100),
+	// Escapes the following character. Defaults to Quote, meaning quotes
+	// inside quoted fields are escaped by doubling them.
+	Escape rune
+
+	// Lines starting with this character are ignored
+	Comment rune
+
+	// Allow quotes to appear unescaped in the middle of fields
+	LazyQuotes bool
+
+	// Ignore white space at the start of fields
+	TrimLeadingSpace bool
+
+	// Number of lines to skip before the header, for files with a preamble
+	SkipLines int
+
+	// Rather than giving up on the first malformed line, pad out short rows,
+	// put extra values in an overflow column and skip lines which can't be
+	// parsed at all. Everything is noted in the store's Problems.
+	Lenient bool
+}
+
+// Name of the column holding any values beyond the expected number
+const OverflowColumn = "[overflow]"
+
+func (opts CSVOptions) withDefaults() CSVOptions {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+
+	if opts.Quote == 0 {
+		opts.Quote = '"'
+	}
+
+	if opts.Escape == 0 {
+		opts.Escape = opts.Quote
+	}
+
+	return opts
+}
+
+func ReadCSVFile(reader io.Reader, opts CSVOptions, readHeader bool, count int64) (*TabularData, error) {
+	data, err := StreamCSVFile(reader, opts, readHeader, count)
+	if err != nil {
+		return nil, err
 	}
 
-	csv.Comma = delimiter
+	return data.collect()
+}
+
+// Like ReadCSVFile, but returns as soon as the header has been read and
+// loads the remaining rows into data.Store in the background.
+func StreamCSVFile(reader io.Reader, opts CSVOptions, readHeader bool, count int64) (*TabularData, error) {
+	csv := newCSVReader(reader, opts)
+
+	data := &TabularData{}
 
 	if readHeader {
 		if headers, err := csv.Read(); err == nil {
 			columns := make([]Column, len(headers))
 			for i, col := range headers {
-				width := clamp(len(col), 1, len(col))
+				width := clamp(displayWidth(col), 1, displayWidth(col))
 				columns[i] = Column{Name: col, Width: width}
 			}
 
@@ -30,40 +83,114 @@ func ReadCSVFile(reader io.Reader, delimiter rune, readHeader bool, count int64)
 		}
 	}
 
-	var i int64
-	for i = 0; i < count; i++ {
+	var first []string
+
+	// Use first row to set number of columns
+	if !readHeader && count > 0 {
 		record, err := csv.Read()
 
 		if err == io.EOF {
-			break
+			data.Store = NewMemoryStore(nil)
+			return data, nil
 		} else if err != nil {
 			return nil, err
 		}
 
-		// Use first row to set number of columns
-		if !readHeader && i == 0 {
-			data.Columns = make([]Column, len(record))
-			for j := range record {
-				name := fmt.Sprintf("[%d]", j)
-				data.Columns[j] = Column{
-					Name:  name,
-					Width: len(name),
-				}
+		data.Columns = make([]Column, len(record))
+		for j := range record {
+			name := fmt.Sprintf("[%d]", j)
+			data.Columns[j] = Column{
+				Name:  name,
+				Width: displayWidth(name),
 			}
 		}
 
-		if len(record) != len(data.Columns) {
-			return nil, errors.New("Row has incorrect number of columns")
+		first = record
+	}
+
+	numColumns := len(data.Columns)
+	store := newLoadingStore()
+	checker := newRecordChecker(&store.loadState, opts, numColumns)
+
+	next := func() ([]string, error) {
+		if first != nil {
+			record := first
+			first = nil
+			return record, nil
 		}
 
-		data.Rows = append(data.Rows, record)
+		for {
+			record, err := csv.Read()
 
-		for j, col := range record {
-			if len(col) > data.Columns[j].Width {
-				data.Columns[j].Width = len(col)
+			if problem, ok := csv.recover(err); ok && opts.Lenient {
+				store.addProblem(problem)
+				continue
+			} else if err != nil {
+				return nil, err
 			}
+
+			return checker.check(record, csv.Line())
 		}
 	}
 
+	go store.load(next, count)
+
+	data.Store = store
 	return data, nil
 }
+
+// Makes sure each record has the expected number of values, or when being
+// lenient forces it to.
+type recordChecker struct {
+	store      *loadState
+	opts       CSVOptions
+	numColumns int
+	overflow   bool
+}
+
+func newRecordChecker(store *loadState, opts CSVOptions, numColumns int) *recordChecker {
+	return &recordChecker{
+		store:      store,
+		opts:       opts.withDefaults(),
+		numColumns: numColumns,
+	}
+}
+
+func (c *recordChecker) check(record []string, line int) ([]string, error) {
+	if len(record) == c.numColumns {
+		return record, nil
+	}
+
+	reason := fmt.Sprintf("expected %d columns, found %d", c.numColumns, len(record))
+	if !c.opts.Lenient {
+		return nil, fmt.Errorf("line %d: Row has incorrect number of columns (%s)", line, reason)
+	}
+
+	c.store.addProblem(LoadProblem{
+		Line:   line,
+		Reason: reason,
+		Text:   strings.Join(record, string(c.opts.Delimiter)),
+	})
+
+	if len(record) > c.numColumns && !c.overflow {
+		c.store.addColumn(OverflowColumn)
+		c.overflow = true
+	}
+
+	return fitRecord(record, c.numColumns, c.opts.Delimiter), nil
+}
+
+// Pad out a short record, or gather up any extra values into a single
+// overflow value.
+func fitRecord(record []string, numColumns int, delimiter rune) []string {
+	if len(record) < numColumns {
+		padded := make([]string, numColumns)
+		copy(padded, record)
+		return padded
+	} else if len(record) > numColumns {
+		overflow := strings.Join(record[numColumns:], string(delimiter))
+		return append(record[:numColumns:numColumns], overflow)
+	}
+
+	return record
+}
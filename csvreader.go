@@ -0,0 +1,329 @@
+// A small replacement for encoding/csv, which doesn't let us change the
+// quote or escape characters.
+
+package vxsv
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type csvReader struct {
+	opts CSVOptions
+
+	reader *bufio.Reader
+	offset int64 // Bytes consumed so far
+	line   int   // Line of the last rune read
+	start  int   // Line the last record started on
+	skip   int   // Lines still to be skipped before the first record
+
+	field   strings.Builder
+	peeked  bool
+	last    rune
+	invalid bool // Whether last came from a byte which isn't valid UTF-8
+	raw     byte // That byte, which is kept as is like encoding/csv does
+	eof     bool
+}
+
+func newCSVReader(reader io.Reader, opts CSVOptions) *csvReader {
+	opts = opts.withDefaults()
+
+	return &csvReader{
+		opts:   opts,
+		reader: bufio.NewReader(reader),
+		line:   1,
+		skip:   opts.SkipLines,
+	}
+}
+
+// Byte offset of the end of the last record read, as with
+// csv.Reader.InputOffset.
+func (r *csvReader) InputOffset() int64 {
+	return r.offset
+}
+
+func (r *csvReader) readRune() (rune, error) {
+	if r.peeked {
+		r.peeked = false
+		return r.last, nil
+	}
+
+	ch, size, err := r.reader.ReadRune()
+	if err != nil {
+		r.eof = err == io.EOF
+		return 0, err
+	}
+
+	r.invalid = ch == utf8.RuneError && size == 1
+	if r.invalid {
+		r.reader.UnreadByte()
+		r.raw, _ = r.reader.ReadByte()
+	}
+
+	r.offset += int64(size)
+	if r.last == '\n' {
+		r.line++
+	}
+
+	r.last = ch
+	return ch, nil
+}
+
+// Add a rune to the field being read. Bytes which aren't valid UTF-8 are
+// read as utf8.RuneError, but end up in the field unchanged.
+func (r *csvReader) writeRune(ch rune) {
+	if ch == utf8.RuneError && r.invalid {
+		r.field.WriteByte(r.raw)
+	} else {
+		r.field.WriteRune(ch)
+	}
+}
+
+// Line number the last record read started on
+func (r *csvReader) Line() int {
+	return r.start
+}
+
+// If err came from a malformed record, skip past the rest of the line it
+// was found on so reading can carry on, and describe what went wrong.
+func (r *csvReader) recover(err error) (LoadProblem, bool) {
+	parseErr, ok := err.(*csv.ParseError)
+	if !ok {
+		return LoadProblem{}, false
+	}
+
+	if !r.atEOF() {
+		r.skipLine()
+	}
+
+	return LoadProblem{Line: parseErr.StartLine, Reason: parseErr.Err.Error()}, true
+}
+
+// Whether the whole input has been consumed
+func (r *csvReader) atEOF() bool {
+	return r.eof
+}
+
+func (r *csvReader) unreadRune() {
+	r.peeked = true
+}
+
+func (r *csvReader) error(start int, err error) error {
+	return &csv.ParseError{StartLine: start, Line: r.line, Err: err}
+}
+
+// Consume everything up to and including the next newline
+func (r *csvReader) skipLine() error {
+	for {
+		if ch, err := r.readRune(); err != nil {
+			return err
+		} else if ch == '\n' {
+			return nil
+		}
+	}
+}
+
+// Consume the lines before the first record, if that hasn't happened yet
+func (r *csvReader) skipPreamble() error {
+	for ; r.skip > 0; r.skip-- {
+		if err := r.skipLine(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read the next record, skipping over blank lines and comments. Returns
+// io.EOF once the input is exhausted.
+func (r *csvReader) Read() ([]string, error) {
+	var ch rune
+	var err error
+
+	if err = r.skipPreamble(); err != nil {
+		return nil, err
+	}
+
+	for {
+		if ch, err = r.readRune(); err != nil {
+			return nil, err
+		} else if r.opts.Comment != 0 && ch == r.opts.Comment {
+			if err = r.skipLine(); err != nil {
+				return nil, err
+			}
+		} else if ch != '\n' && ch != '\r' {
+			break
+		}
+	}
+
+	r.unreadRune()
+
+	r.start = r.line
+	start := r.start
+	record := []string{}
+
+	for {
+		r.field.Reset()
+
+		if r.opts.TrimLeadingSpace {
+			if err = r.skipSpace(); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+
+		if ch, err = r.readRune(); err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if err == nil && ch == r.opts.Quote {
+			if err = r.readQuoted(start); err != nil {
+				return nil, err
+			}
+		} else if err == nil {
+			r.unreadRune()
+			if err = r.readUnquoted(start); err != nil {
+				return nil, err
+			}
+		}
+
+		record = append(record, r.field.String())
+
+		// Field is followed by a delimiter, a newline, or the end of input
+		if ch, err = r.readRune(); err == io.EOF {
+			return record, nil
+		} else if err != nil {
+			return nil, err
+		} else if ch == '\n' {
+			return record, nil
+		}
+	}
+}
+
+func (r *csvReader) skipSpace() error {
+	for {
+		ch, err := r.readRune()
+		if err != nil {
+			return err
+		}
+
+		if ch == '\n' || ch == r.opts.Delimiter || !unicode.IsSpace(ch) {
+			r.unreadRune()
+			return nil
+		}
+	}
+}
+
+// Read up to (but not including) the next delimiter or newline
+func (r *csvReader) readUnquoted(start int) error {
+	for {
+		ch, err := r.readRune()
+		if err == io.EOF {
+			r.trimCarriageReturn()
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case ch == r.opts.Delimiter:
+			r.unreadRune()
+			return nil
+		case ch == '\n':
+			r.unreadRune()
+			r.trimCarriageReturn()
+			return nil
+		case ch == r.opts.Escape && r.opts.Escape != r.opts.Quote:
+			if err = r.readEscaped(start); err != nil {
+				return err
+			}
+		case ch == r.opts.Quote && !r.opts.LazyQuotes:
+			return r.error(start, csv.ErrBareQuote)
+		default:
+			r.writeRune(ch)
+		}
+	}
+}
+
+// Read the rest of a quoted field, up to the next delimiter or newline
+func (r *csvReader) readQuoted(start int) error {
+	for {
+		ch, err := r.readRune()
+		if err == io.EOF {
+			return r.error(start, csv.ErrQuote)
+		} else if err != nil {
+			return err
+		}
+
+		if ch == '\n' {
+			r.trimCarriageReturn()
+		}
+
+		if ch == r.opts.Escape && ch != r.opts.Quote {
+			if err = r.readEscaped(start); err != nil {
+				return err
+			}
+
+			continue
+		} else if ch != r.opts.Quote {
+			r.writeRune(ch)
+			continue
+		}
+
+		// Either an escaped quote, or the end of the field
+		next, err := r.readRune()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case next == r.opts.Quote && r.opts.Escape == r.opts.Quote:
+			r.writeRune(ch)
+		case next == r.opts.Delimiter, next == '\n':
+			r.unreadRune()
+			return nil
+		case next == '\r':
+			// Only valid as part of a "\r\n" line ending
+			if next, err = r.readRune(); err == nil && next == '\n' {
+				r.unreadRune()
+				return nil
+			}
+
+			fallthrough
+		default:
+			if !r.opts.LazyQuotes || err != nil {
+				return r.error(start, csv.ErrQuote)
+			}
+
+			// A stray quote in the middle of the field
+			r.writeRune(ch)
+			r.unreadRune()
+		}
+	}
+}
+
+// Take the character following an escape literally
+func (r *csvReader) readEscaped(start int) error {
+	ch, err := r.readRune()
+	if err == io.EOF {
+		return r.error(start, csv.ErrQuote)
+	} else if err != nil {
+		return err
+	}
+
+	r.writeRune(ch)
+	return nil
+}
+
+// Treat "\r\n" line endings the same as "\n"
+func (r *csvReader) trimCarriageReturn() {
+	if str := r.field.String(); strings.HasSuffix(str, "\r") {
+		r.field.Reset()
+		r.field.WriteString(str[:len(str)-1])
+	}
+}
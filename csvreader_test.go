@@ -0,0 +1,196 @@
+package vxsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Every record in input, along with the offset after each.
+func readCSVRecords(input string, opts CSVOptions) ([][]string, []int64, error) {
+	reader := newCSVReader(strings.NewReader(input), opts)
+
+	var records [][]string
+	var offsets []int64
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, offsets, nil
+		} else if err != nil {
+			return records, offsets, err
+		}
+
+		records = append(records, record)
+		offsets = append(offsets, reader.InputOffset())
+	}
+}
+
+func TestCSVReaderMatchesEncodingCSV(t *testing.T) {
+	inputs := []string{
+		"a,b,c\n1,2,3\n",
+		"a,b\n1,2",
+		"a,,c\n,,\n",
+		"\"a,b\",\"c\nd\"\n",
+		"\"a \"\"quoted\"\" word\",b\n",
+		"a,b\r\n1,2\r\n",
+		"\"a\r\nb\",c\r\n",
+		"a,b\n\n\n1,2\n",
+		"naïve,日本語,😀\n",
+		"a\xffb,\"\xfe\"\n",
+	}
+
+	for _, input := range inputs {
+		records, offsets, err := readCSVRecords(input, CSVOptions{})
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(input))
+		reader.FieldsPerRecord = -1
+
+		var want [][]string
+		var wantOffsets []int64
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%q: encoding/csv: %v", input, err)
+			}
+
+			want = append(want, record)
+			wantOffsets = append(wantOffsets, reader.InputOffset())
+		}
+
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("%q: records = %q, want %q", input, records, want)
+		}
+
+		if !reflect.DeepEqual(offsets, wantOffsets) {
+			t.Errorf("%q: offsets = %v, want %v", input, offsets, wantOffsets)
+		}
+	}
+}
+
+func TestCSVReaderDialects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  CSVOptions
+		want  [][]string
+	}{
+		{
+			name:  "doubled quotes",
+			input: "\"say \"\"hi\"\"\",b\n",
+			want:  [][]string{{`say "hi"`, "b"}},
+		},
+		{
+			name:  "escape inside quotes",
+			input: "\"say \\\"hi\\\"\",\"back\\\\slash\"\n",
+			opts:  CSVOptions{Escape: '\\'},
+			want:  [][]string{{`say "hi"`, `back\slash`}},
+		},
+		{
+			name:  "escape outside quotes",
+			input: "a\\,b,c\\\nd\n",
+			opts:  CSVOptions{Escape: '\\'},
+			want:  [][]string{{"a,b", "c\nd"}},
+		},
+		{
+			name:  "CRLF inside and outside quotes",
+			input: "\"a\r\nb\",c\r\nd,e\r\n",
+			want:  [][]string{{"a\nb", "c"}, {"d", "e"}},
+		},
+		{
+			name:  "comments",
+			input: "# header comment\na,b\n#1,2\n3,4\n",
+			opts:  CSVOptions{Comment: '#'},
+			want:  [][]string{{"a", "b"}, {"3", "4"}},
+		},
+		{
+			name:  "trim leading space",
+			input: "a,   b,\t\"c\"\n",
+			opts:  CSVOptions{TrimLeadingSpace: true},
+			want:  [][]string{{"a", "b", "c"}},
+		},
+		{
+			name:  "lazy stray quotes",
+			input: "a\"b,c\n\"d\"e\",f\n",
+			opts:  CSVOptions{LazyQuotes: true},
+			want:  [][]string{{`a"b`, "c"}, {`d"e`, "f"}},
+		},
+		{
+			name:  "lazy trailing quotes",
+			input: "ab\",c\"\n",
+			opts:  CSVOptions{LazyQuotes: true},
+			want:  [][]string{{`ab"`, `c"`}},
+		},
+		{
+			name:  "other delimiter and quote",
+			input: "'a;b';c\n",
+			opts:  CSVOptions{Delimiter: ';', Quote: '\''},
+			want:  [][]string{{"a;b", "c"}},
+		},
+		{
+			name:  "invalid UTF-8 is kept",
+			input: "a\xffb,\"\xfe\"\n",
+			want:  [][]string{{"a\xffb", "\xfe"}},
+		},
+	}
+
+	for _, test := range tests {
+		records, _, err := readCSVRecords(test.input, test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !reflect.DeepEqual(records, test.want) {
+			t.Errorf("%s: records = %q, want %q", test.name, records, test.want)
+		}
+	}
+}
+
+func TestCSVReaderErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		opts      CSVOptions
+		err       error
+		startLine int
+	}{
+		{"unterminated quote", "a,b\n1,\"2\n3\n", CSVOptions{}, csv.ErrQuote, 2},
+		{"unterminated escape", "a,b\\", CSVOptions{Escape: '\\'}, csv.ErrQuote, 1},
+		{"bare quote", "a,b\"c\n", CSVOptions{}, csv.ErrBareQuote, 1},
+		{"quote before end of field", "\"a\"b,c\n", CSVOptions{}, csv.ErrQuote, 1},
+	}
+
+	for _, test := range tests {
+		_, _, err := readCSVRecords(test.input, test.opts)
+
+		var parseErr *csv.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: err = %v, want a csv.ParseError", test.name, err)
+		} else if parseErr.Err != test.err || parseErr.StartLine != test.startLine {
+			t.Errorf("%s: err = %v on line %d, want %v on line %d",
+				test.name, parseErr.Err, parseErr.StartLine, test.err, test.startLine)
+		}
+	}
+}
+
+func TestCSVReaderInputOffset(t *testing.T) {
+	input := "a,b\n# comment\n\"c\nd\",e\r\n\nf,g"
+
+	_, offsets, err := readCSVRecords(input, CSVOptions{Comment: '#'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{4, 23, 27}
+	if !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+}
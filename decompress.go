@@ -0,0 +1,77 @@
+package vxsv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type compression struct {
+	name  string
+	magic []byte
+	open  func(io.Reader) (io.Reader, error)
+
+	// Checks the rest of the header, for formats whose magic is short
+	// enough to turn up at the start of plain text
+	check func(header []byte) bool
+}
+
+var compressions = []compression{
+	{"gzip", []byte{0x1f, 0x8b}, func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}, nil},
+	{"bzip2", []byte("BZh"), func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	}, isBzip2},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r)
+	}, nil},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}, func(r io.Reader) (io.Reader, error) {
+		return zstd.NewReader(r)
+	}, nil},
+}
+
+// Magic numbers starting a bzip2 block, and the end of the stream for input
+// with no blocks at all
+var (
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// "BZh" is followed by the block size, from '1' to '9', and then either the
+// first block or the end of the stream.
+func isBzip2(header []byte) bool {
+	if len(header) < 10 || header[3] < '1' || header[3] > '9' {
+		return false
+	}
+
+	return bytes.HasPrefix(header[4:], bzip2BlockMagic) || bytes.HasPrefix(header[4:], bzip2EndMagic)
+}
+
+// Decompress sniffs the first few bytes of reader, and if they look like
+// gzip, bzip2, xz or zstd data returns a reader for the decompressed stream
+// along with the name of the compression format. Anything else is passed
+// through untouched, with an empty name.
+func Decompress(reader io.Reader) (io.Reader, string, error) {
+	buffered := bufio.NewReader(reader)
+
+	// A short read just means the input is too small to be compressed
+	header, err := buffered.Peek(10)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+
+	for _, c := range compressions {
+		if bytes.HasPrefix(header, c.magic) && (c.check == nil || c.check(header)) {
+			decompressed, err := c.open(buffered)
+			return decompressed, c.name, err
+		}
+	}
+
+	return buffered, "", nil
+}
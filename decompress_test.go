@@ -0,0 +1,56 @@
+package vxsv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	bzipped := func(hexData string) string {
+		data, err := hex.DecodeString(hexData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	tests := []struct {
+		name        string
+		input       string
+		compression string
+		want        string
+	}{
+		{"plain", "a,b\n1,2\n", "", "a,b\n1,2\n"},
+		{"plain starting with BZh", "BZh,col\n1,2\n", "", "BZh,col\n1,2\n"},
+		{"plain starting with BZh and a digit", "BZh9 col\n1 2\n", "", "BZh9 col\n1 2\n"},
+		{"short", "BZh", "", "BZh"},
+		{
+			"bzip2",
+			bzipped("425a6839314159265359bf87407f00000359000010000430003000200030c00869b28823278bb9229c28485fc3a03f80"),
+			"bzip2",
+			"a,b\n1,2\n",
+		},
+		{"empty bzip2", bzipped("425a683917724538509000000000"), "bzip2", ""},
+	}
+
+	for _, test := range tests {
+		reader, compression, err := Decompress(bytes.NewBufferString(test.input))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if compression != test.compression {
+			t.Errorf("%s: compression = %q, want %q", test.name, compression, test.compression)
+		}
+
+		if got, err := io.ReadAll(reader); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if string(got) != test.want {
+			t.Errorf("%s: read %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package vxsv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// How much of the input to look at when guessing its encoding or format
+const SampleSize = 64 * 1024
+
+var byteOrderMarks = []struct {
+	name string
+	mark []byte
+}{
+	{"utf-8", []byte{0xef, 0xbb, 0xbf}},
+	{"utf-16le", []byte{0xff, 0xfe}},
+	{"utf-16be", []byte{0xfe, 0xff}},
+}
+
+// Decode transcodes reader to UTF-8, returning the name of the encoding that
+// was used. name may be any encoding label understood by web browsers
+// ("latin1", "windows-1252", "utf-16le", ...), or empty to guess. A byte
+// order mark at the start of the input takes precedence either way, and is
+// stripped.
+func Decode(reader io.Reader, name string) (io.Reader, string, error) {
+	buffered, sample, err := peekSample(reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var enc encoding.Encoding
+
+	if name == "" {
+		name, enc = guessEncoding(sample)
+	} else if enc, err = htmlindex.Get(name); err != nil {
+		return nil, "", fmt.Errorf("Unknown encoding \"%s\"", name)
+	} else if canonical, err := htmlindex.Name(enc); err == nil {
+		name = canonical
+	}
+
+	hasBOM := false
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(sample, bom.mark) {
+			name = bom.name + " (BOM)"
+			hasBOM = true
+			break
+		}
+	}
+
+	// Nothing to do, don't bother paying for the transform
+	if enc == unicode.UTF8 && !hasBOM {
+		return buffered, name, nil
+	}
+
+	return transform.NewReader(buffered, unicode.BOMOverride(enc.NewDecoder())), name, nil
+}
+
+// Return a buffered reader along with a peek at its first few KB. Only what
+// the first read gives us is used, so a followed file or slow pipe doesn't
+// block waiting for a full sample.
+func peekSample(reader io.Reader) (*bufio.Reader, []byte, error) {
+	buffered := bufio.NewReaderSize(reader, SampleSize)
+
+	if _, err := buffered.Peek(1); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	sample, _ := buffered.Peek(buffered.Buffered())
+	return buffered, sample, nil
+}
+
+// Without a BOM we can only make an educated guess. UTF-16 text is full of
+// NUL bytes, and anything which isn't valid UTF-8 is most likely an export
+// from Excel or some other legacy Windows program.
+func guessEncoding(sample []byte) (string, encoding.Encoding) {
+	var evenNuls, oddNuls int
+	for i, b := range sample {
+		if b == 0 && i%2 == 0 {
+			evenNuls++
+		} else if b == 0 {
+			oddNuls++
+		}
+	}
+
+	switch {
+	case oddNuls > len(sample)/4 && evenNuls == 0:
+		return "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case evenNuls > len(sample)/4 && oddNuls == 0:
+		return "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case !validUTF8Prefix(sample):
+		return "windows-1252", charmap.Windows1252
+	}
+
+	return "utf-8", unicode.UTF8
+}
+
+// Like utf8.Valid, but allows the sample to end part way through a rune.
+func validUTF8Prefix(sample []byte) bool {
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+
+		if r == utf8.RuneError && size == 1 {
+			return len(sample) < utf8.UTFMax && !utf8.FullRune(sample)
+		}
+
+		sample = sample[size:]
+	}
+
+	return true
+}
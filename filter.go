@@ -88,15 +88,7 @@ func (ui *UI) parseFilter(fs string) (Filter, error) {
 			value  = strings.TrimSpace(match[3])
 		)
 
-		filter.colIdx = -1
-		for i, col := range ui.columns {
-			if col.Name == column {
-				filter.colIdx = i
-				break
-			}
-		}
-
-		if filter.colIdx == -1 {
+		if filter.colIdx = ui.columnIndex(column); filter.colIdx == -1 {
 			return nil, fmt.Errorf("No such column: \"%s\"", column)
 		}
 
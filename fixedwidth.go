@@ -0,0 +1,167 @@
+// Reading fixed width records, which have no delimiters between fields.
+
+package vxsv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FixedWidthField says where a field lies within each line, in characters
+// counting from 0.
+type FixedWidthField struct {
+	Name   string
+	Start  int
+	Length int
+}
+
+// ParseFixedWidths reads a comma separated list of field widths, such as
+// "10,8,20", for fields which follow on from each other.
+func ParseFixedWidths(spec string) ([]FixedWidthField, error) {
+	var fields []FixedWidthField
+	start := 0
+
+	for _, width := range strings.Split(spec, ",") {
+		length, err := strconv.Atoi(strings.TrimSpace(width))
+		if err != nil || length < 1 {
+			return nil, fmt.Errorf("Invalid field width \"%s\"", width)
+		}
+
+		fields = append(fields, FixedWidthField{Start: start, Length: length})
+		start += length
+	}
+
+	return fields, nil
+}
+
+// ReadFixedWidthSpec reads a record layout naming each field, one per line
+// as its name, starting column and length, e.g.
+//
+//	# name    start  length
+//	account   1      10
+//	branch    11     8
+//
+// Starting columns count from 1, as they do in most layout documents. Blank
+// lines and lines starting with # are skipped, and commas can be used in
+// place of spaces.
+func ReadFixedWidthSpec(reader io.Reader) ([]FixedWidthField, error) {
+	scanner := bufio.NewScanner(reader)
+
+	var fields []FixedWidthField
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: expected a name, start and length", line)
+		}
+
+		start, err := strconv.Atoi(parts[1])
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("line %d: invalid start \"%s\"", line, parts[1])
+		}
+
+		length, err := strconv.Atoi(parts[2])
+		if err != nil || length < 1 {
+			return nil, fmt.Errorf("line %d: invalid length \"%s\"", line, parts[2])
+		}
+
+		fields = append(fields, FixedWidthField{Name: parts[0], Start: start - 1, Length: length})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if len(fields) == 0 {
+		return nil, errors.New("no fields given")
+	}
+
+	return fields, nil
+}
+
+// ReadFixedWidthFile slices each line into the given fields, trimming the
+// padding around values. When readHeader is set the first line is sliced up
+// the same way to name the columns, otherwise fields without a name are
+// numbered.
+func ReadFixedWidthFile(reader io.Reader, fields []FixedWidthField, readHeader bool, skipLines int, count int64) (*TabularData, error) {
+	data, err := StreamFixedWidthFile(reader, fields, readHeader, skipLines, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
+
+// Like ReadFixedWidthFile, but loads rows into data.Store in the background.
+func StreamFixedWidthFile(reader io.Reader, fields []FixedWidthField, readHeader bool, skipLines int, count int64) (*TabularData, error) {
+	scanner := bufio.NewScanner(reader)
+
+	// Skip any preamble before the header
+	for i := 0; i < skipLines; i++ {
+		if !scanner.Scan() {
+			break
+		}
+	}
+
+	var header []string
+	if readHeader && scanner.Scan() {
+		header = sliceFixedWidth(scanner.Text(), fields)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	columns := make([]Column, len(fields))
+	for i, field := range fields {
+		name := field.Name
+		if header != nil {
+			name = header[i]
+		}
+
+		if name == "" {
+			name = fmt.Sprintf("[%d]", i)
+		}
+
+		columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	next := func() ([]string, error) {
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.TrimSpace(line) != "" {
+				return sliceFixedWidth(line, fields), nil
+			}
+		}
+
+		return nil, scannerDone(scanner)
+	}
+
+	return &TabularData{
+		Columns: columns,
+		Store:   streamRows(next, count),
+	}, nil
+}
+
+// Values of each field in line, which may be too short to hold them all.
+func sliceFixedWidth(line string, fields []FixedWidthField) []string {
+	runes := []rune(strings.TrimRight(line, "\r"))
+	row := make([]string, len(fields))
+
+	for i, field := range fields {
+		start := min(field.Start, len(runes))
+		end := min(field.Start+field.Length, len(runes))
+
+		row[i] = strings.TrimSpace(string(runes[start:end]))
+	}
+
+	return row
+}
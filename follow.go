@@ -0,0 +1,30 @@
+package vxsv
+
+import (
+	"io"
+	"time"
+)
+
+// How long to wait before checking a followed input for more data
+const FollowInterval = 250 * time.Millisecond
+
+type followReader struct {
+	reader io.Reader
+}
+
+// NewFollowReader wraps a file or pipe that is still being written to. Rather
+// than stopping at EOF, reads block until more data shows up, like `tail -f`.
+func NewFollowReader(reader io.Reader) io.Reader {
+	return &followReader{reader}
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.reader.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+
+		time.Sleep(FollowInterval)
+	}
+}
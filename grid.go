@@ -0,0 +1,206 @@
+// Reading tables drawn with borders, as found in READMEs and tickets.
+
+package vxsv
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Characters which rules between rows are drawn with
+const tableRuleChars = "-=+:|" +
+	"─━═│┃║" +
+	"┌┐└┘├┤┬┴┼┏┓┗┛┣┫┳┻╋" +
+	"╒╕╘╛╞╡╤╧╪╓╖╙╜╟╢╥╨╫╔╗╚╝╠╣╦╩╬"
+
+// Characters which fill in the cells of a rule
+const tableRuleFill = "-=:─━═"
+
+// Vertical lines between cells of box drawing tables
+const boxSeparators = "│┃║"
+
+// Parses Markdown, org-mode, ASCII grid and box drawing tables:
+//
+//	| colA | colB |    | colA | colB |    +------+------+    ┌──────┬──────┐
+//	|------|-----:|    |------+------|    | colA | colB |    │ colA │ colB │
+//	| foo  | bar  |    | foo  | bar  |    +======+======+    ├──────┼──────┤
+//	| foo2 | bar2 |    | foo2 | bar2 |    | foo  | bar  |    │ foo  │ bar  │
+//	                                      +------+------+    └──────┴──────┘
+//
+// Cells are split at the column separators rather than by position, so rows
+// don't need to line up, and Markdown's outer pipes are optional. Rules
+// between rows are skipped if they're drawn like the first rule under the
+// header, and the table ends at the first line which isn't part of it.
+func ReadGridTable(reader io.Reader, count int64) (*TabularData, error) {
+	data, err := StreamGridTable(reader, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
+
+// Like ReadGridTable, but loads rows into data.Store in the background.
+func StreamGridTable(reader io.Reader, count int64) (*TabularData, error) {
+	scanner := bufio.NewScanner(reader)
+
+	// Skip any top border, along with anything before the table
+	var header []string
+	var bordered bool
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !isTableRule(line) && strings.ContainsAny(line, "|"+boxSeparators) {
+			header = splitGridRow(line)
+			bordered = startsWithSeparator(line)
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	columns := make([]Column, len(header))
+	for i, name := range header {
+		columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	// Rows of placeholders such as "| - | - |" look like rules too
+	var rule string
+
+	next := func() ([]string, error) {
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			if isTableRule(line) {
+				if rule == "" {
+					rule = ruleShape(line)
+				}
+
+				if ruleShape(line) == rule {
+					continue
+				}
+			}
+
+			// Anything that isn't part of the table ends it, such as the
+			// formulas under an org-mode table
+			if bordered && !startsWithSeparator(line) || !strings.ContainsAny(line, "|"+boxSeparators) {
+				return nil, io.EOF
+			}
+
+			return fitGridRow(splitGridRow(line), len(columns)), nil
+		}
+
+		return nil, scannerDone(scanner)
+	}
+
+	return &TabularData{
+		Columns: columns,
+		Store:   streamRows(next, count),
+	}, nil
+}
+
+// Whether line is a rule between rows, such as "+----+----+", "|:---|---:|"
+// or "├────┼────┤".
+func isTableRule(line string) bool {
+	line = strings.TrimSpace(line)
+	if !strings.ContainsAny(line, "-=─━═") {
+		return false
+	}
+
+	for _, r := range line {
+		if r != ' ' && !strings.ContainsRune(tableRuleChars, r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Where the cells of a rule start and end, whatever they're drawn with, so
+// that "+----+----+" and "+====+====+" are the same shape but "| -  | -  |"
+// is not.
+func ruleShape(line string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return r
+		case strings.ContainsRune(tableRuleFill, r):
+			return '-'
+		}
+
+		return '+'
+	}, strings.TrimSpace(line))
+}
+
+func startsWithSeparator(line string) bool {
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(line))
+	return r == '|' || strings.ContainsRune(boxSeparators, r)
+}
+
+// Trimmed cells of a row, without its outer borders. Box drawing tables are
+// split at their vertical lines, leaving any pipes in values alone, while
+// ASCII tables are split at pipes that aren't escaped with a backslash.
+func splitGridRow(line string) []string {
+	line = strings.TrimSpace(line)
+
+	separators := "|"
+	if strings.ContainsAny(line, boxSeparators) {
+		separators = boxSeparators
+	}
+
+	isSeparator := func(r rune) bool {
+		return strings.ContainsRune(separators, r)
+	}
+
+	// Only one border each side, so empty cells at the edges are kept
+	if r, size := utf8.DecodeRuneInString(line); isSeparator(r) {
+		line = line[size:]
+	}
+
+	if r, size := utf8.DecodeLastRuneInString(line); isSeparator(r) {
+		line = line[:len(line)-size]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			if r != '|' {
+				cell.WriteRune('\\')
+			}
+
+			cell.WriteRune(r)
+			escaped = false
+		case r == '\\' && separators == "|":
+			escaped = true
+		case isSeparator(r):
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteRune(r)
+		}
+	}
+
+	if escaped {
+		cell.WriteRune('\\')
+	}
+
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// Pad out short rows, and keep anything past the last column in it.
+func fitGridRow(row []string, numColumns int) []string {
+	if len(row) > numColumns && numColumns > 0 {
+		last := strings.Join(row[numColumns-1:], " | ")
+		return append(row[:numColumns-1:numColumns-1], last)
+	}
+
+	return fitRecord(row, numColumns, 0)
+}
@@ -0,0 +1,53 @@
+package vxsv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadGridTableKeepsPlaceholderRows(t *testing.T) {
+	tests := map[string]string{
+		"markdown": `
+| name | value |
+|------|------:|
+| foo  | 1     |
+| -    | -     |
+| bar  | 2     |
+`,
+		"grid": `
++------+-------+
+| name | value |
++======+=======+
+| foo  | 1     |
++------+-------+
+| -    | -     |
++------+-------+
+| bar  | 2     |
++------+-------+
+`,
+		"box drawing": `
+┌──────┬───────┐
+│ name │ value │
+├──────┼───────┤
+│ foo  │ 1     │
+│ -    │ -     │
+│ bar  │ 2     │
+└──────┴───────┘
+`,
+	}
+
+	want := [][]string{{"foo", "1"}, {"-", "-"}, {"bar", "2"}}
+
+	for name, input := range tests {
+		data, err := ReadGridTable(strings.NewReader(input), 100)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(data.Rows, want) {
+			t.Errorf("%s: rows = %q, want %q", name, data.Rows, want)
+		}
+	}
+}
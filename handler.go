@@ -10,10 +10,10 @@ import (
 	"io/ioutil"
 	"math"
 	"os/exec"
-	"sort"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/montanaflynn/stats"
 	"github.com/nsf/termbox-go"
@@ -30,14 +30,14 @@ type HandlerDefault struct {
 
 func (h *HandlerDefault) Repaint() {
 	ui := h.ui
-	ui.writeModeLine(":", []string{})
+	ui.writeModeLine(":", []string{ui.name, ui.tableLabel()})
 }
 
 func (h *HandlerDefault) HandleKey(ev termbox.Event) {
 	ui := h.ui
 	vw, vh := ui.viewSize()
 
-	maxYOffset := clamp(len(ui.filterMatches)-(vh-2), 0, len(ui.filterMatches)-1)
+	maxYOffset := ui.maxOffsetY()
 	lastColumnOffset, colWidth := ui.columnOffset(len(ui.columns) - 1)
 	endOfLine := (lastColumnOffset + colWidth) - vw
 
@@ -59,22 +59,32 @@ func (h *HandlerDefault) HandleKey(ev termbox.Event) {
 		ui.offsetX = clamp(ui.offsetX-5, 0, endOfLine)
 	case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
 		ui.offsetY = clamp(ui.offsetY-1, 0, maxYOffset)
+		ui.tailing = false
 	case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
 		ui.offsetY = clamp(ui.offsetY+1, 0, maxYOffset)
 	case ev.Ch == '/', ev.Key == termbox.KeyCtrlR:
 		ui.pushHandler(&HandlerFilter{*h, ui.filter.String()})
 		ui.offsetY = 0
+		ui.tailing = false
 	case ev.Key == termbox.KeySpace:
 		ui.offsetY = clamp(ui.offsetY+vh, 0, maxYOffset)
 	case unicode.ToLower(ev.Ch) == 'c':
+		// Such as a result set printed without a header
+		if len(ui.columns) == 0 {
+			ui.pushHandler(NewPopup(h.ui, "There are no columns to select in this table."))
+			break
+		}
+
 		ui.pushHandler(NewColumnSelect(h.ui))
 		ui.offsetX = 0
 	case unicode.ToLower(ev.Ch) == 'r':
 		ui.pushHandler(&HandlerRowSelect{*h, h.ui.offsetY})
 	case ev.Ch == 'G':
 		ui.offsetY = maxYOffset
+		ui.tailing = true
 	case ev.Ch == 'g':
 		ui.offsetY = 0
+		ui.tailing = false
 	case ev.Ch == 'Z':
 		ui.zebraStripe = !ui.zebraStripe
 	case ev.Ch == 'X':
@@ -89,6 +99,24 @@ func (h *HandlerDefault) HandleKey(ev termbox.Event) {
 		}
 
 		ui.allExpanded = !ui.allExpanded
+	case ev.Key == termbox.KeyF5:
+		if ui.loader != nil {
+			ui.reload()
+		} else {
+			ui.pushHandler(NewPopup(h.ui, "Can't reload, the input wasn't read from a file."))
+		}
+	case ev.Ch == 'i':
+		ui.pushInfoPopup()
+	case ev.Ch == 'E':
+		ui.pushProblemsPopup()
+	case ev.Ch == 'M':
+		ui.pushMessagesPopup()
+	case ev.Key == termbox.KeyTab:
+		ui.nextTable()
+	case ev.Ch == 'T':
+		ui.PickTable()
+	case ev.Ch == 'Q':
+		ui.editQuery()
 	case ev.Ch == '?':
 		ui.pushHandler(NewPopup(h.ui, HelpText))
 	}
@@ -104,14 +132,13 @@ func (h *HandlerFilter) Repaint() {
 	_, height := termbox.Size()
 
 	ui.writeModeLine("Filter", []string{h.filter})
-	termbox.SetCursor(len("filter")+1+len(h.filter), height-1)
+	termbox.SetCursor(len("filter")+1+displayWidth(h.filter), height-1)
 }
 
 func handlePromptKey(ev termbox.Event, str *string) (consumed bool) {
 	if ev.Key == termbox.KeyDelete || ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
-		if sz := len(*str); sz > 0 {
-			*str = (*str)[:sz-1]
-		}
+		_, size := utf8.DecodeLastRuneInString(*str)
+		*str = (*str)[:len(*str)-size]
 	} else if ev.Key == termbox.KeyCtrlW || ev.Key == termbox.KeyCtrlU {
 		*str = ""
 	} else if ev.Key == termbox.KeySpace {
@@ -155,6 +182,43 @@ func (h *HandlerFilter) HandleKey(ev termbox.Event) {
 	}
 }
 
+type HandlerQuery struct {
+	HandlerDefault
+	query string
+}
+
+func (h *HandlerQuery) Repaint() {
+	ui := h.ui
+	width, height := termbox.Size()
+
+	// Keep the end of long queries, where the cursor is, in view
+	query := h.query
+	if room := width - len("query") - 2; room > 0 {
+		for displayWidth(query) > room {
+			_, size := utf8.DecodeRuneInString(query)
+			query = query[size:]
+		}
+	}
+
+	ui.writeModeLine("Query", []string{query})
+	termbox.SetCursor(len("query")+1+displayWidth(query), height-1)
+}
+
+func (h *HandlerQuery) HandleKey(ev termbox.Event) {
+	if handlePromptKey(ev, &h.query) {
+		return
+	} else if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG {
+		h.ui.popHandler()
+	} else if ev.Key == termbox.KeyEnter {
+		query := strings.TrimSpace(h.query)
+		h.ui.popHandler()
+
+		if query != "" {
+			h.ui.runQuery(query)
+		}
+	}
+}
+
 type HandlerShell struct {
 	HandlerDefault
 
@@ -184,13 +248,14 @@ func (h *HandlerShell) applyCommand() {
 		panic(err)
 	}
 
+	rowCount := h.ui.rowCount
+
 	go func() {
 		defer in.Close()
 
-		for i := range h.ui.rows {
-			row := h.ui.getRow(i)
+		h.ui.scanRows(0, rowCount, func(_ int, row []string) {
 			io.WriteString(in, row[h.colIdx]+"\n")
-		}
+		})
 	}()
 
 	if err := cmd.Start(); err != nil {
@@ -198,10 +263,10 @@ func (h *HandlerShell) applyCommand() {
 	}
 
 	if h.replaceValues {
-		modifiedColumn := make([]string, len(h.ui.rows))
+		modifiedColumn := make([]string, rowCount)
 
 		scanner := bufio.NewScanner(out)
-		for i := 0; i < len(h.ui.rows); i++ {
+		for i := 0; i < rowCount; i++ {
 			if !scanner.Scan() {
 				output, _ := ioutil.ReadAll(errOut)
 				h.ui.pushErrorPopup("Process exited too early!", fmt.Errorf("%s", output))
@@ -253,7 +318,7 @@ func (h *HandlerShell) Repaint() {
 	_, height := termbox.Size()
 
 	h.ui.writeModeLine("Run shell", []string{h.command})
-	termbox.SetCursor(len("run shell")+1+len(h.command), height-1)
+	termbox.SetCursor(len("run shell")+1+displayWidth(h.command), height-1)
 }
 
 type HandlerRowSelect struct {
@@ -264,6 +329,9 @@ type HandlerRowSelect struct {
 func (h *HandlerRowSelect) HandleKey(ev termbox.Event) {
 	ui := h.ui
 
+	// Rows may have gone since the row was selected, such as by reloading
+	h.rowIdx = clamp(h.rowIdx, 0, len(ui.filterMatches)-1)
+
 	switch {
 	case ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG:
 		ui.popHandler()
@@ -272,6 +340,10 @@ func (h *HandlerRowSelect) HandleKey(ev termbox.Event) {
 	case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
 		h.rowIdx = clamp(h.rowIdx+1, 0, len(ui.filterMatches)-1)
 	case ev.Key == termbox.KeyEnter:
+		if len(ui.filterMatches) == 0 {
+			break
+		}
+
 		jsonObj := make(map[string]interface{})
 
 		rowIdx := ui.filterMatches[h.rowIdx]
@@ -341,30 +413,6 @@ func (h *HandlerColumnSelect) selectColumn(idx int) {
 	}
 }
 
-func (h *HandlerColumnSelect) Len() int {
-	return len(h.ui.filterMatches)
-}
-
-func (h *HandlerColumnSelect) Swap(i, j int) {
-	h.ui.filterMatches[i], h.ui.filterMatches[j] = h.ui.filterMatches[j], h.ui.filterMatches[i]
-}
-
-func (h *HandlerColumnSelect) Less(i, j int) bool {
-	ui := h.ui
-
-	row1 := ui.getRow(ui.filterMatches[i])
-	row2 := ui.getRow(ui.filterMatches[j])
-
-	v1, err1 := strconv.ParseFloat(row1[h.column], 32)
-	v2, err2 := strconv.ParseFloat(row2[h.column], 32)
-
-	if err1 == nil && err2 == nil {
-		return v1 < v2
-	}
-
-	return row1[h.column] < row2[h.column]
-}
-
 func (h *HandlerColumnSelect) Repaint() {
 	ui := h.ui
 
@@ -388,9 +436,9 @@ func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
 		next := ui.findNextColumn(h.column, -1)
 		h.selectColumn(clamp(next, 0, len(ui.columns)-1))
 	case ev.Ch == '<':
-		sort.Stable(h)
+		ui.sortBy(h.column, false)
 	case ev.Ch == '>':
-		sort.Stable(sort.Reverse(h))
+		ui.sortBy(h.column, true)
 	case unicode.ToLower(ev.Ch) == 'c':
 		h.selectColumn(0)
 	case ev.Ch == 'w':
@@ -414,21 +462,7 @@ func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
 		commandStr := ui.columns[h.column].ModifiedCommand
 		h.ui.pushHandler(&HandlerShell{HandlerDefault{ui}, h.column, commandStr, false})
 	case ev.Ch == 'u':
-		rows := make([]int, 0, len(ui.filterMatches))
-		set := make(map[string]struct{})
-
-		for _, i := range ui.filterMatches {
-			row := ui.getRow(i)
-			val := row[h.column]
-
-			// Take the first row with each value
-			if _, present := set[val]; !present {
-				set[val] = struct{}{}
-				rows = append(rows, i)
-			}
-		}
-
-		ui.filterMatches = rows
+		ui.toggleUnique(h.column)
 	case ev.Ch == 's':
 		var (
 			min, max, stdev    float64
@@ -444,13 +478,12 @@ func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
 		colName := ui.columns[h.column].Name
 
 		data := make(stats.Float64Data, 0, len(ui.filterMatches)+1)
-		for _, rowIdx := range ui.filterMatches {
-			row := ui.getRow(rowIdx)
+		ui.scanMatches(func(_ int, row []string) {
 			trimmed := strings.TrimSpace(row[h.column])
 			if val, err := strconv.ParseFloat(trimmed, 64); err == nil {
 				data = append(data, val)
 			}
-		}
+		})
 
 		if len(data) == 0 {
 			data = []float64{0.0, 0.0, 0.0, 0.0}
@@ -504,8 +537,8 @@ func (h *HandlerColumnSelect) HandleKey(ev termbox.Event) {
   p90: %15.4f      p25:    %15.4f
   p95: %15.4f      p50:    %15.4f
   p99: %15.4f      p75:    %15.4f`,
-			colName, strings.Repeat("-", 4+len(colName)),
-			len(ui.filterMatches), len(ui.rows), len(data),
+			colName, strings.Repeat("-", 4+displayWidth(colName)),
+			len(ui.filterMatches), ui.rowCount, len(data),
 			min, mean, max, median, sum, mode, variance, stdev,
 			p90, quartiles.Q1, p95, quartiles.Q2, p99, quartiles.Q3)
 
@@ -584,18 +617,8 @@ func (h *HandlerPopup) Repaint() {
 		} else if i < popupH {
 			border = borders[1]
 			if i+h.offsetY < len(h.content) {
-				content = h.content[i+h.offsetY]
-
 				// Horizontal scrolling
-				if h.offsetX > len(content) {
-					content = ""
-				} else {
-					content = content[h.offsetX:]
-				}
-
-				if len(content) >= popupW {
-					content = content[0:popupW]
-				}
+				content = sliceWidth(h.content[i+h.offsetY], h.offsetX, popupW)
 			} else {
 				content = " "
 			}
@@ -604,7 +627,7 @@ func (h *HandlerPopup) Repaint() {
 			content = strings.Repeat("─", popupW)
 		}
 
-		line := fmt.Sprintf("%s%-*s%s", border[0], popupW, content, border[1])
+		line := border[0] + padRight(content, popupW) + border[1]
 		writeString(x, y+i, termbox.ColorDefault, termbox.ColorDefault, line)
 	}
 
@@ -635,3 +658,102 @@ func (h *HandlerPopup) HandleKey(ev termbox.Event) {
 		h.offsetY = clamp(h.offsetY+1, 0, maxScroll)
 	}
 }
+
+// HandlerPicker is a popup list to choose one item from, such as a table.
+type HandlerPicker struct {
+	HandlerDefault
+
+	title    string
+	items    []string
+	selected int
+	offsetY  int
+	onSelect func(idx int)
+}
+
+func NewPicker(ui *UI, title string, items []string, selected int, onSelect func(int)) *HandlerPicker {
+	return &HandlerPicker{
+		HandlerDefault: HandlerDefault{ui},
+		title:          title,
+		items:          items,
+		selected:       selected,
+		onSelect:       onSelect,
+	}
+}
+
+func (h *HandlerPicker) size() (int, int) {
+	width, height := termbox.Size()
+
+	popupW := displayWidth(h.title) + 4
+	for _, item := range h.items {
+		popupW = max(popupW, displayWidth(item))
+	}
+
+	popupW = clamp(popupW, 20, width-15)
+	popupH := clamp(len(h.items), 1, height-5)
+
+	return popupW, popupH
+}
+
+func (h *HandlerPicker) Repaint() {
+	width, height := termbox.Size()
+	popupW, popupH := h.size()
+
+	x := width/2 - popupW/2
+	y := height/2 - popupH/2
+
+	// Keep the selection in view
+	h.offsetY = clamp(h.offsetY, h.selected-popupH+1, h.selected)
+
+	title := fmt.Sprintf("[ %s ]", h.title)
+	top := "┌─" + title + strings.Repeat("─", max(popupW-displayWidth(title), 0)) + "─┐"
+	writeString(x, y-1, termbox.ColorDefault, termbox.ColorDefault, top)
+
+	for i := 0; i < popupH; i++ {
+		idx := i + h.offsetY
+
+		item := ""
+		if idx < len(h.items) {
+			item = h.items[idx]
+		}
+
+		item = sliceWidth(item, 0, popupW)
+
+		fg, bg := termbox.ColorDefault, termbox.ColorDefault
+		if idx == h.selected {
+			fg, bg = HiliteFg, HiliteBg
+		}
+
+		writeString(x, y+i, termbox.ColorDefault, termbox.ColorDefault, "│ ")
+		writeString(x+2, y+i, fg, bg, padRight(item, popupW))
+		writeString(x+2+popupW, y+i, termbox.ColorDefault, termbox.ColorDefault, " │")
+	}
+
+	bottom := "└─" + strings.Repeat("─", popupW) + "─┘"
+	writeString(x, y+popupH, termbox.ColorDefault, termbox.ColorDefault, bottom)
+
+	h.ui.writeModeLine("Pick", []string{h.items[h.selected]})
+}
+
+func (h *HandlerPicker) HandleKey(ev termbox.Event) {
+	_, popupH := h.size()
+
+	switch {
+	case ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlG || ev.Ch == 'q':
+		h.ui.popHandler()
+	case ev.Key == termbox.KeyEnter:
+		h.ui.popHandler()
+		h.onSelect(h.selected)
+	case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+		h.selected = clamp(h.selected-1, 0, len(h.items)-1)
+	case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+		h.selected = clamp(h.selected+1, 0, len(h.items)-1)
+	case ev.Key == termbox.KeyPgup:
+		h.selected = clamp(h.selected-popupH, 0, len(h.items)-1)
+	case ev.Key == termbox.KeyPgdn || ev.Key == termbox.KeySpace:
+		h.selected = clamp(h.selected+popupH, 0, len(h.items)-1)
+	case ev.Ch == 'g':
+		h.selected = 0
+	case ev.Ch == 'G':
+		h.selected = len(h.items) - 1
+	}
+}
@@ -0,0 +1,248 @@
+// Reading the tables of an HTML page.
+
+package vxsv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Longest name given to a table from its caption or headers
+const MaxHTMLTableName = 40
+
+// ReadHTMLTables reads every <table> of an HTML page, each of which becomes
+// one of the returned table's Tables. Tables are named by their caption, or
+// failing that their first header row. Header cells become the column names,
+// and cells spanning several columns or rows have their value repeated in
+// each of them.
+func ReadHTMLTables(reader io.Reader, count int64) (*TabularData, error) {
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*TabularData
+	names := make(map[string]bool)
+
+	var find func(node *html.Node)
+	find = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.DataAtom == atom.Table {
+			table := readHTMLTable(node, count)
+
+			// Names have to be unique to switch between tables by name
+			name := table.Table
+			if name == "" {
+				name = fmt.Sprintf("table %d", len(tables)+1)
+			}
+
+			for i := 2; names[name]; i++ {
+				name = fmt.Sprintf("%s (%d)", table.Table, i)
+			}
+
+			names[name] = true
+			table.Table = name
+			tables = append(tables, table)
+		}
+
+		// Nested tables are listed after the one holding them
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			find(child)
+		}
+	}
+
+	find(doc)
+
+	if len(tables) == 0 {
+		return nil, errors.New("No <table> found in HTML")
+	}
+
+	data := tables[0]
+	if len(tables) > 1 {
+		data.Tables = tables
+	}
+
+	data.Source.Format = "html"
+	return data, nil
+}
+
+func readHTMLTable(table *html.Node, count int64) *TabularData {
+	var caption string
+	var header, body [][]string
+
+	// Cells carried down into later rows by rowspan, by column
+	spans := make(map[int]htmlSpan)
+
+	for _, row := range htmlTableRows(table, &caption) {
+		cells, isHeader := readHTMLRow(row, spans)
+
+		// Header rows are those in <thead>, or that only have <th> cells
+		// before the first row of data
+		if isHeader && len(body) == 0 {
+			header = append(header, cells)
+		} else if int64(len(body)) < count {
+			body = append(body, cells)
+		}
+	}
+
+	numColumns := 0
+	for _, row := range append(header, body...) {
+		numColumns = max(numColumns, len(row))
+	}
+
+	data := &TabularData{Columns: make([]Column, numColumns)}
+
+	for i := range data.Columns {
+		// Grouped headers are combined, e.g. "Sales" above "Q1"
+		var parts []string
+		for _, row := range header {
+			if i < len(row) && row[i] != "" && (len(parts) == 0 || parts[len(parts)-1] != row[i]) {
+				parts = append(parts, row[i])
+			}
+		}
+
+		name := strings.Join(parts, " ")
+		if name == "" {
+			name = fmt.Sprintf("[%d]", i)
+		}
+
+		data.Columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	for _, row := range body {
+		row = fitRecord(row, numColumns, 0)
+		fitColumns(data.Columns, row)
+		data.Rows = append(data.Rows, row)
+	}
+
+	data.Table = caption
+	if data.Table == "" && len(header) > 0 {
+		data.Table = strings.Join(header[0], ", ")
+	}
+
+	if utf8.RuneCountInString(data.Table) > MaxHTMLTableName {
+		data.Table = string([]rune(data.Table)[:MaxHTMLTableName-1]) + "…"
+	}
+
+	return data
+}
+
+type htmlSpan struct {
+	value string
+	rows  int
+}
+
+// The <tr> elements of a table, leaving out those of any nested tables.
+// The caption is picked up along the way.
+func htmlTableRows(table *html.Node, caption *string) []*html.Node {
+	var rows []*html.Node
+
+	for child := table.FirstChild; child != nil; child = child.NextSibling {
+		switch child.DataAtom {
+		case atom.Caption:
+			*caption = htmlText(child)
+		case atom.Tr:
+			rows = append(rows, child)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			for row := child.FirstChild; row != nil; row = row.NextSibling {
+				if row.DataAtom == atom.Tr {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+
+	return rows
+}
+
+// Values of a row's cells, spread across the columns they span, and whether
+// it's a header row.
+func readHTMLRow(row *html.Node, spans map[int]htmlSpan) ([]string, bool) {
+	var cells []string
+	isHeader := row.Parent.DataAtom == atom.Thead
+
+	// Fill in cells spanning down from earlier rows
+	carry := func() {
+		for {
+			span, ok := spans[len(cells)]
+			if !ok {
+				return
+			}
+
+			cells = append(cells, span.value)
+
+			if span.rows--; span.rows == 0 {
+				delete(spans, len(cells)-1)
+			} else {
+				spans[len(cells)-1] = span
+			}
+		}
+	}
+
+	sawData := false
+	for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+		if cell.DataAtom != atom.Td && cell.DataAtom != atom.Th {
+			continue
+		}
+
+		sawData = sawData || cell.DataAtom == atom.Td
+		value := htmlText(cell)
+
+		carry()
+		for i := 0; i < htmlSpanAttr(cell, "colspan"); i++ {
+			if rows := htmlSpanAttr(cell, "rowspan"); rows > 1 {
+				spans[len(cells)] = htmlSpan{value, rows - 1}
+			}
+
+			cells = append(cells, value)
+		}
+	}
+
+	carry()
+
+	return cells, isHeader || (!sawData && len(cells) > 0)
+}
+
+func htmlSpanAttr(node *html.Node, name string) int {
+	for _, attr := range node.Attr {
+		if attr.Key == name {
+			// Browsers cap spans too, so a typo can't create millions of cells
+			if n, err := strconv.Atoi(strings.TrimSpace(attr.Val)); err == nil && n > 0 {
+				return min(n, 1000)
+			}
+		}
+	}
+
+	return 1
+}
+
+// Text of a node with its whitespace collapsed, as a browser would show it.
+func htmlText(node *html.Node) string {
+	var text strings.Builder
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch {
+		case node.Type == html.TextNode:
+			text.WriteString(node.Data)
+		case node.DataAtom == atom.Br:
+			text.WriteString(" ")
+		case node.DataAtom == atom.Script, node.DataAtom == atom.Style, node.DataAtom == atom.Table:
+			return
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+
+	walk(node)
+
+	return strings.Join(strings.Fields(text.String()), " ")
+}
@@ -0,0 +1,308 @@
+// Random access storage for files too large to keep in memory.
+
+package vxsv
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// Number of decoded rows an IndexedStore keeps around
+const RowCacheSize = 10000
+
+// IndexedStore scans a CSV file once to remember where each row starts, then
+// parses rows from the file on demand as they are needed.
+type IndexedStore struct {
+	loadState
+
+	file    io.ReaderAt
+	base    int64 // Where the first row starts, past any BOM
+	opts    CSVOptions
+	offsets []int64
+	widths  []int
+
+	// Expected number of values in a row, not counting any overflow column
+	numColumns int
+	cache      *rowCache
+}
+
+// Stores which keep track of column widths themselves, so the UI doesn't
+// need to look at every row as it arrives.
+type columnWidther interface {
+	ColumnWidths() []int
+}
+
+// Like ReadCSVFile, but only an index of row offsets is kept in memory. The
+// index is built in the background.
+func IndexCSVFile(file io.ReaderAt, opts CSVOptions, readHeader bool, count int64) (*TabularData, error) {
+	var start int64
+
+	// Don't let a UTF-8 byte order mark end up in the first column name
+	bom := make([]byte, 3)
+	if n, _ := file.ReadAt(bom, 0); n == len(bom) && bytes.Equal(bom, byteOrderMarks[0].mark) {
+		start = int64(len(bom))
+	}
+
+	csv := newCSVReader(io.NewSectionReader(file, start, math.MaxInt64-start), opts)
+
+	data := &TabularData{}
+
+	if readHeader {
+		headers, err := csv.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		data.Columns = make([]Column, len(headers))
+		for i, col := range headers {
+			width := clamp(displayWidth(col), 1, displayWidth(col))
+			data.Columns[i] = Column{Name: col, Width: width}
+		}
+	}
+
+	store := &IndexedStore{
+		loadState: newLoadState(true),
+		file:      file,
+		base:      start,
+		opts:      opts,
+		offsets:   make([]int64, 0, 1000),
+		cache:     newRowCache(RowCacheSize),
+	}
+
+	var first []string
+	var firstOffset int64
+
+	// Use first row to set number of columns
+	if !readHeader && count > 0 {
+		// Offsets have to be past the preamble, as Row doesn't skip it
+		var record []string
+		err := csv.skipPreamble()
+		if err == nil {
+			firstOffset = start + csv.InputOffset()
+			record, err = csv.Read()
+		}
+
+		if err == io.EOF {
+			store.finish(nil)
+			data.Store = store
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		data.Columns = make([]Column, len(record))
+		for j := range record {
+			name := fmt.Sprintf("[%d]", j)
+			data.Columns[j] = Column{Name: name, Width: displayWidth(name)}
+		}
+
+		first = record
+	}
+
+	store.numColumns = len(data.Columns)
+	store.widths = make([]int, store.numColumns)
+
+	if first != nil {
+		store.offsets = append(store.offsets, firstOffset)
+		store.fit(first)
+		count--
+	}
+
+	// The rest of the index is built in the background
+	checker := newRecordChecker(&store.loadState, opts, store.numColumns)
+	go store.scan(csv, checker, count)
+
+	data.Store = store
+	return data, nil
+}
+
+func (s *IndexedStore) scan(csv *csvReader, checker *recordChecker, count int64) {
+	var err error
+
+	for indexed := int64(0); indexed < count; {
+		offset := s.base + csv.InputOffset()
+
+		var record []string
+		record, err = csv.Read()
+
+		if problem, ok := csv.recover(err); ok && s.opts.Lenient {
+			s.addProblem(problem)
+			continue
+		} else if err != nil {
+			break
+		}
+
+		if record, err = checker.check(record, csv.Line()); err != nil {
+			break
+		}
+
+		s.mu.Lock()
+		s.offsets = append(s.offsets, offset)
+		s.fit(record)
+		s.mu.Unlock()
+
+		s.notify()
+		indexed++
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+
+	s.finish(err)
+}
+
+// Must be called with the lock held.
+func (s *IndexedStore) fit(record []string) {
+	// Lenient loading may have added an overflow column
+	for len(s.widths) < len(record) {
+		s.widths = append(s.widths, 0)
+	}
+
+	for i, cell := range record {
+		if width := displayWidth(cell); width > s.widths[i] {
+			s.widths[i] = width
+		}
+	}
+}
+
+func (s *IndexedStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.offsets)
+}
+
+func (s *IndexedStore) ColumnWidths() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]int(nil), s.widths...)
+}
+
+func (s *IndexedStore) Row(idx int) []string {
+	if row, ok := s.cache.get(idx); ok {
+		return row
+	}
+
+	s.mu.RLock()
+	offset := s.offsets[idx]
+	s.mu.RUnlock()
+
+	row := s.checkRow(s.readerAt(offset, 0).Read())
+
+	s.cache.put(idx, row)
+	return row
+}
+
+// How much of the file ScanRows reads at a time
+const scanBufferSize = 64 * 1024
+
+// ScanRows calls fn with each row from start up to end, reading them from
+// the file in one pass rather than seeking to each. Rows aren't cached, so
+// that scanning the whole file doesn't push out the ones being looked at.
+func (s *IndexedStore) ScanRows(start, end int, fn func(idx int, row []string)) {
+	s.mu.RLock()
+	offsets := s.offsets[start:end]
+	s.mu.RUnlock()
+
+	var csv *csvReader
+	var base int64
+
+	for i, offset := range offsets {
+		// Lenient loading may have skipped over lines between rows
+		if csv == nil || base+csv.InputOffset() != offset {
+			csv, base = s.readerAt(offset, scanBufferSize), offset
+		}
+
+		fn(start+i, s.checkRow(csv.Read()))
+	}
+}
+
+// Read rows from offset onwards, with a larger buffer than usual if size
+// isn't zero.
+func (s *IndexedStore) readerAt(offset int64, size int) *csvReader {
+	// Offsets are already past any lines that needed skipping
+	opts := s.opts
+	opts.SkipLines = 0
+
+	reader := io.Reader(io.NewSectionReader(s.file, offset, math.MaxInt64-offset))
+	if size > 0 {
+		reader = bufio.NewReaderSize(reader, size)
+	}
+
+	return newCSVReader(reader, opts)
+}
+
+// Fit a row read from the file to the columns
+func (s *IndexedStore) checkRow(row []string, err error) []string {
+	if err == nil && len(row) != s.numColumns {
+		row = fitRecord(row, s.numColumns, s.opts.Delimiter)
+	} else if err != nil {
+		// Most likely the file changed underneath us. Don't bring down the
+		// UI, but make it obvious something is wrong.
+		row = make([]string, s.numColumns)
+		if s.numColumns > 0 {
+			row[0] = fmt.Sprintf("<error: %v>", err)
+		}
+	}
+
+	return row
+}
+
+// Least recently used cache of decoded rows.
+type rowCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[int]*list.Element
+}
+
+type rowCacheEntry struct {
+	idx int
+	row []string
+}
+
+func newRowCache(size int) *rowCache {
+	return &rowCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[int]*list.Element, size),
+	}
+}
+
+func (c *rowCache) get(idx int) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[idx]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*rowCacheEntry).row, true
+	}
+
+	return nil, false
+}
+
+func (c *rowCache) put(idx int, row []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[idx]; ok {
+		c.order.MoveToFront(elem)
+		elem.Value.(*rowCacheEntry).row = row
+		return
+	}
+
+	c.entries[idx] = c.order.PushFront(&rowCacheEntry{idx, row})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*rowCacheEntry).idx)
+	}
+}
@@ -0,0 +1,55 @@
+package vxsv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexCSVFileSkipsPreambleWithoutHeader(t *testing.T) {
+	input := "exported 2020-01-01\nby nobody\na,1\nb,2\n"
+	opts := CSVOptions{Delimiter: ',', SkipLines: 2}
+
+	data, err := IndexCSVFile(strings.NewReader(input), opts, false, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := data.Store.(*IndexedStore)
+	if err := store.wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows [][]string
+	for i := 0; i < store.Len(); i++ {
+		rows = append(rows, store.Row(i))
+	}
+
+	want := [][]string{{"a", "1"}, {"b", "2"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestIndexedStoreScanRowsMatchesRow(t *testing.T) {
+	input := "a,b\n1,2\n# comment\n\n3,4\n\"bad\"quote,5\n6,7\n8\n9,10,11\n"
+	opts := CSVOptions{Delimiter: ',', Comment: '#', Lenient: true}
+
+	data, err := IndexCSVFile(strings.NewReader(input), opts, true, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := data.Store.(*IndexedStore)
+	if err := store.wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	for start := 0; start < store.Len(); start++ {
+		store.ScanRows(start, store.Len(), func(idx int, row []string) {
+			if want := store.Row(idx); !reflect.DeepEqual(row, want) {
+				t.Errorf("scanning from %d, row %d = %q, want %q", start, idx, row, want)
+			}
+		})
+	}
+}
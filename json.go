@@ -0,0 +1,559 @@
+package vxsv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Shown in place of JSON nulls, and for keys missing from an object
+const JSONNull = "null"
+
+// Parses JSON Lines / NDJSON, one object per line:
+//
+// {"id": 1, "user": {"name": "foo", "tags": ["a", "b"]}}
+// {"id": 2, "user": {"name": "bar"}, "deleted": true}
+//
+// Nested objects are flattened into dotted column names (user.name), and
+// arrays are kept as compact JSON. Columns are the union of the keys seen on
+// every line, in the order they first appear.
+func ReadJSONLines(reader io.Reader, lenient bool, count int64) (*TabularData, error) {
+	data, err := StreamJSONLines(reader, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
+
+// Like ReadJSONLines, but returns as soon as the first object has been read
+// and loads the remaining rows into data.Store in the background. Keys which
+// first show up later on become the store's extra columns.
+func StreamJSONLines(reader io.Reader, lenient bool, count int64) (*TabularData, error) {
+	lines := newLineReader(reader)
+
+	// Read and flatten the object on each line
+	next := func() ([]jsonField, error) {
+		line, err := lines.next()
+		if err != nil {
+			return nil, err
+		}
+
+		fields, err := flattenJSON([]byte(line))
+		if err != nil {
+			return nil, &jsonRecordError{LoadProblem{
+				Line:   lines.line,
+				Reason: err.Error(),
+				Text:   line,
+			}}
+		}
+
+		return fields, nil
+	}
+
+	data, err := streamJSONRecords(next, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Source.Format = "json lines"
+	return data, nil
+}
+
+// Yields the flattened fields of the next record, or io.EOF once there are
+// no more.
+type jsonSource func() ([]jsonField, error)
+
+// Fill a table from source in the background, once the first record has
+// been used to set up the columns.
+func streamJSONRecords(source jsonSource, lenient bool, count int64) (*TabularData, error) {
+	data, next, err := jsonRecordRows(source, JSONNull, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	go data.Store.(*MemoryStore).load(next, count)
+
+	return data, nil
+}
+
+// Set up the columns of a table from the first record of source, returning
+// the table with an empty store for next to fill.
+func jsonRecordRows(source jsonSource, missing string, lenient bool, count int64) (*TabularData, rowSource, error) {
+	store := newLoadingStore()
+	table := newJSONTable(&store.loadState, missing)
+
+	data := &TabularData{Null: missing, Store: store}
+
+	// Skip over records which aren't objects when being lenient
+	nextFields := func() ([]jsonField, error) {
+		for {
+			fields, err := source()
+
+			if problem, ok := err.(*jsonRecordError); ok && lenient {
+				store.addProblem(problem.LoadProblem)
+				continue
+			}
+
+			return fields, err
+		}
+	}
+
+	var first []string
+
+	// Use first object to set the initial columns
+	if count > 0 {
+		fields, err := nextFields()
+		if err == io.EOF {
+			return data, func() ([]string, error) { return nil, io.EOF }, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		// These columns aren't extra, so don't tell the store about them
+		table.register(fields)
+		table.added = len(table.columns)
+
+		for _, name := range table.columns {
+			data.Columns = append(data.Columns, Column{Name: name, Width: displayWidth(name)})
+		}
+
+		first = table.row(fields)
+	}
+
+	next := func() ([]string, error) {
+		if first != nil {
+			row := first
+			first = nil
+			return row, nil
+		}
+
+		fields, err := nextFields()
+		if err != nil {
+			return nil, err
+		}
+
+		return table.row(fields), nil
+	}
+
+	return data, next, nil
+}
+
+// A record which isn't a JSON object
+type jsonRecordError struct {
+	LoadProblem
+}
+
+func (e *jsonRecordError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// Parses a JSON document holding an array of records, either at the top
+// level or nested inside objects:
+//
+// {"data": {"items": [{"id": 1, ...}, {"id": 2, ...}]}}
+//
+// path picks out the array with dotted keys ("data.items"), using numbers to
+// index into any arrays along the way ("results.0.rows"). Records are
+// flattened the same way as in ReadJSONLines.
+func ReadJSONDocument(reader io.Reader, path string, lenient bool, count int64) (*TabularData, error) {
+	data, err := StreamJSONDocument(reader, path, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
+
+// Like ReadJSONDocument, but loads the records into data.Store in the
+// background. Only one record is decoded at a time, so the document can be
+// larger than memory.
+func StreamJSONDocument(reader io.Reader, path string, lenient bool, count int64) (*TabularData, error) {
+	lines := &lineCounter{reader: reader}
+	decoder := json.NewDecoder(lines)
+	decoder.UseNumber()
+
+	segments := parseJSONPath(path)
+	if err := seekJSONPath(decoder, segments); err != nil {
+		return nil, err
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	} else if token == json.Delim('{') && len(segments) == 0 {
+		return nil, fmt.Errorf("Expected an array of records, not an object (keys: %s)", listJSONKeys(decoder))
+	} else if token != json.Delim('[') {
+		return nil, fmt.Errorf("Expected an array of records at \"%s\"", strings.Join(segments, "."))
+	}
+
+	source := func() ([]jsonField, error) {
+		if !decoder.More() {
+			return nil, io.EOF
+		}
+
+		line := lines.lineAt(decoder.InputOffset())
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		fields, err := flattenJSON(raw)
+		if err != nil {
+			return nil, &jsonRecordError{LoadProblem{
+				Line:   line,
+				Reason: err.Error(),
+				Text:   jsonValue(raw),
+			}}
+		}
+
+		return fields, nil
+	}
+
+	data, err := streamJSONRecords(source, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Source.Format = "json document"
+	if len(segments) > 0 {
+		data.Source.Format += fmt.Sprintf(" (path %s)", strings.Join(segments, "."))
+	}
+
+	return data, nil
+}
+
+// Like StreamJSONLines or StreamJSONDocument, depending on what the input
+// looks like. Giving a path means the input is a document.
+func StreamJSON(reader io.Reader, path string, lenient bool, count int64) (*TabularData, error) {
+	buffered, sample, err := peekSample(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" || isJSONDocument(sample) {
+		return StreamJSONDocument(buffered, path, lenient, count)
+	}
+
+	return StreamJSONLines(buffered, lenient, count)
+}
+
+// Documents either start with an array, or have an object which is spread
+// over several lines. Anything else is assumed to be JSON lines.
+func isJSONDocument(sample []byte) bool {
+	sample = bytes.TrimLeft(sample, " \t\r\n")
+	if len(sample) == 0 {
+		return false
+	} else if sample[0] == '[' {
+		return true
+	}
+
+	idx := bytes.IndexByte(sample, '\n')
+	if idx == -1 {
+		return false
+	}
+
+	_, err := flattenJSON(sample[:idx])
+	return err != nil
+}
+
+// Split up a path like "data.items", "$.results[0].rows" or ".data.items"
+func parseJSONPath(path string) []string {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	var segments []string
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+// Advance decoder to the value found by following path from the top of the
+// document.
+func seekJSONPath(decoder *json.Decoder, path []string) error {
+	for depth, key := range path {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		found := false
+
+		switch token {
+		case json.Delim('{'):
+			for decoder.More() {
+				name, err := decoder.Token()
+				if err != nil {
+					return err
+				} else if name == key {
+					found = true
+					break
+				}
+
+				if err := skipJSONValue(decoder); err != nil {
+					return err
+				}
+			}
+		case json.Delim('['):
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				break
+			}
+
+			for i := 0; decoder.More(); i++ {
+				if i == idx {
+					found = true
+					break
+				}
+
+				if err := skipJSONValue(decoder); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("Nothing found at \"%s\"", strings.Join(path[:depth+1], "."))
+		}
+	}
+
+	return nil
+}
+
+func skipJSONValue(decoder *json.Decoder) error {
+	var raw json.RawMessage
+	return decoder.Decode(&raw)
+}
+
+// Most keys to list when complaining that the document is an object
+const maxJSONKeys = 10
+
+// Names of the remaining keys of an object, to suggest as a path.
+func listJSONKeys(decoder *json.Decoder) string {
+	var keys []string
+
+	for decoder.More() && len(keys) < maxJSONKeys {
+		token, err := decoder.Token()
+		if err != nil || skipJSONValue(decoder) != nil {
+			break
+		}
+
+		keys = append(keys, token.(string))
+	}
+
+	if decoder.More() {
+		keys = append(keys, "...")
+	}
+
+	return strings.Join(keys, ", ")
+}
+
+// Works out line numbers from the byte offsets reported by json.Decoder,
+// which reads ahead of what it has decoded. Offsets must be asked for in
+// increasing order.
+type lineCounter struct {
+	reader io.Reader
+
+	pending []byte // Read, but not yet counted
+	offset  int64  // Offset of the start of pending
+	line    int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.pending = append(c.pending, p[:n]...)
+	return n, err
+}
+
+// Line number of the first value after offset, skipping over any white
+// space or separators in between.
+func (c *lineCounter) lineAt(offset int64) int {
+	n := clamp(int(offset-c.offset), 0, len(c.pending))
+
+	for n < len(c.pending) && bytes.IndexByte([]byte(" \t\r\n,"), c.pending[n]) != -1 {
+		n++
+	}
+
+	c.line += bytes.Count(c.pending[:n], []byte("\n"))
+	c.pending = append(c.pending[:0], c.pending[n:]...)
+	c.offset += int64(n)
+
+	return c.line + 1
+}
+
+// Reads the non-blank lines of an input, keeping track of line numbers.
+// Shared by the formats holding one record per line.
+type lineReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newLineReader(reader io.Reader) *lineReader {
+	return &lineReader{reader: bufio.NewReader(reader)}
+}
+
+// The next non-blank line, with the white space around it trimmed
+func (r *lineReader) next() (string, error) {
+	for {
+		line, err := r.reader.ReadString('\n')
+		if len(line) == 0 && err != nil {
+			return "", err
+		} else if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		r.line++
+
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+	}
+}
+
+type jsonField struct {
+	name  string
+	value string
+}
+
+// Maps flattened keys onto columns as they're discovered.
+type jsonTable struct {
+	store   *loadState
+	columns []string
+	index   map[string]int
+
+	// How many of columns have been handed to the store, or were part of
+	// the initial columns
+	added int
+
+	// Value of fields which a record doesn't have
+	missing string
+}
+
+func newJSONTable(store *loadState, missing string) *jsonTable {
+	return &jsonTable{store: store, index: make(map[string]int), missing: missing}
+}
+
+// Give any keys we haven't seen before a column
+func (t *jsonTable) register(fields []jsonField) {
+	for _, field := range fields {
+		if _, ok := t.index[field.name]; !ok {
+			t.index[field.name] = len(t.columns)
+			t.columns = append(t.columns, field.name)
+		}
+	}
+}
+
+func (t *jsonTable) row(fields []jsonField) []string {
+	t.register(fields)
+
+	// New columns have to exist before the row which needs them
+	for ; t.added < len(t.columns); t.added++ {
+		t.store.addColumn(t.columns[t.added])
+	}
+
+	row := make([]string, len(t.columns))
+	for i := range row {
+		row[i] = t.missing
+	}
+
+	for _, field := range fields {
+		row[t.index[field.name]] = field.value
+	}
+
+	return row
+}
+
+var errNotObject = errors.New("expected a JSON object")
+
+// Flatten a single JSON object, keeping the order its keys appear in.
+func flattenJSON(text []byte) ([]jsonField, error) {
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+
+	if token, err := decoder.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('{') {
+		return nil, errNotObject
+	}
+
+	fields, err := flattenObject(decoder, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after object")
+	}
+
+	return fields, nil
+}
+
+// Read the members of an object whose opening brace has already been
+// consumed, up to and including the closing brace.
+func flattenObject(decoder *json.Decoder, prefix string, fields []jsonField) ([]jsonField, error) {
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		name := prefix + token.(string)
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		// Recurse into non-empty objects, anything else is a single value
+		if raw[0] == '{' {
+			nested := json.NewDecoder(bytes.NewReader(raw))
+			nested.UseNumber()
+			nested.Token()
+
+			if nested.More() {
+				if fields, err = flattenObject(nested, name+".", fields); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+		}
+
+		fields = append(fields, jsonField{name: name, value: jsonValue(raw)})
+	}
+
+	// Closing brace
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// Display form of a scalar or array
+func jsonValue(raw json.RawMessage) string {
+	switch raw[0] {
+	case '"':
+		var str string
+		if err := json.Unmarshal(raw, &str); err == nil {
+			return str
+		}
+	case '[', '{':
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err == nil {
+			return compact.String()
+		}
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,237 @@
+// Reading logfmt and web server access logs.
+
+package vxsv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parses logfmt, as written by many Go and Heroku services:
+//
+// level=info msg="request done" path=/api dur=12ms
+// level=error msg="upstream timeout" path=/api retries=3
+//
+// Columns are the union of the keys seen on every line, in the order they
+// first appear, with keys missing from a line shown as null. Keys without a
+// value are left blank.
+func ReadLogfmt(reader io.Reader, lenient bool, count int64) (*TabularData, error) {
+	data, err := StreamLogfmt(reader, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
+
+// Like ReadLogfmt, but returns as soon as the first line has been read and
+// loads the remaining rows into data.Store in the background. Keys which
+// first show up later on become the store's extra columns.
+func StreamLogfmt(reader io.Reader, lenient bool, count int64) (*TabularData, error) {
+	lines := newLineReader(reader)
+
+	next := func() ([]jsonField, error) {
+		line, err := lines.next()
+		if err != nil {
+			return nil, err
+		}
+
+		fields, err := parseLogfmt(line)
+		if err != nil {
+			return nil, &jsonRecordError{LoadProblem{
+				Line:   lines.line,
+				Reason: err.Error(),
+				Text:   line,
+			}}
+		}
+
+		return fields, nil
+	}
+
+	data, err := streamJSONRecords(next, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Source.Format = "logfmt"
+	return data, nil
+}
+
+var errNotLogfmt = errors.New("expected key=value pairs")
+
+// Split a line into its keys and values.
+func parseLogfmt(line string) ([]jsonField, error) {
+	var fields []jsonField
+	hasValue := false
+
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(line) && line[i] > ' ' && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("unexpected %q at column %d", line[i], i+1)
+		}
+
+		var value string
+		if i < len(line) && line[i] == '=' {
+			i++
+			hasValue = true
+
+			if i < len(line) && line[i] == '"' {
+				end := i + 1
+				for end < len(line) && line[end] != '"' {
+					if line[end] == '\\' {
+						end++
+					}
+
+					end++
+				}
+
+				if end >= len(line) {
+					return nil, fmt.Errorf("unterminated quoted value for %s", key)
+				}
+
+				// Fall back to the raw contents for escapes Go doesn't know
+				var err error
+				if value, err = strconv.Unquote(line[i : end+1]); err != nil {
+					value = line[i+1 : end]
+				}
+
+				i = end + 1
+			} else {
+				start := i
+				for i < len(line) && line[i] > ' ' {
+					i++
+				}
+
+				value = line[start:i]
+			}
+		}
+
+		fields = append(fields, jsonField{name: key, value: value})
+	}
+
+	// Plain text such as a stack trace would otherwise become a row of
+	// nonsense keys
+	if !hasValue {
+		return nil, errNotLogfmt
+	}
+
+	return fields, nil
+}
+
+// Fields of the combined log format, as used for the access logs of Apache
+// and nginx. The common log format stops after bytes.
+var AccessLogColumns = []string{
+	"ip", "user", "time", "method", "path", "protocol", "status", "bytes", "referrer", "user_agent",
+}
+
+var accessLogRegex = regexp.MustCompile(
+	`^(\S+) \S+ (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}|-) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+// Parses Apache and nginx access logs in the combined or common log format:
+//
+// 127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://x/" "Mozilla/4.08"
+//
+// Times are rewritten as "2000-10-10 13:55:36 -0700" so that they sort, and
+// the request is split into its method, path and protocol.
+func ReadAccessLog(reader io.Reader, lenient bool, count int64) (*TabularData, error) {
+	data, err := StreamAccessLog(reader, lenient, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
+
+// Like ReadAccessLog, but loads rows into data.Store in the background.
+func StreamAccessLog(reader io.Reader, lenient bool, count int64) (*TabularData, error) {
+	lines := newLineReader(reader)
+	store := newLoadingStore()
+
+	next := func() ([]string, error) {
+		for {
+			line, err := lines.next()
+			if err != nil {
+				return nil, err
+			}
+
+			if row := parseAccessLogLine(line); row != nil {
+				return row, nil
+			}
+
+			problem := LoadProblem{Line: lines.line, Reason: "not in the combined log format", Text: line}
+			if !lenient {
+				return nil, fmt.Errorf("line %d: %s", problem.Line, problem.Reason)
+			}
+
+			store.addProblem(problem)
+		}
+	}
+
+	go store.load(next, count)
+
+	data := &TabularData{Store: store}
+	for _, name := range AccessLogColumns {
+		data.Columns = append(data.Columns, Column{Name: name, Width: displayWidth(name)})
+	}
+
+	return data, nil
+}
+
+func parseAccessLogLine(line string) []string {
+	match := accessLogRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+
+	ip, user, timestamp, request, status, size := match[1], match[2], match[3], match[4], match[5], match[6]
+
+	if parsed, err := time.Parse("02/Jan/2006:15:04:05 -0700", timestamp); err == nil {
+		timestamp = parsed.Format("2006-01-02 15:04:05 -0700")
+	}
+
+	// Garbage sent by scanners doesn't always split into three
+	method, path, protocol := "", request, ""
+	if parts := strings.Fields(request); len(parts) == 3 || len(parts) == 2 {
+		method, path = parts[0], parts[1]
+		if len(parts) == 3 {
+			protocol = parts[2]
+		}
+	}
+
+	if user == "-" {
+		user = ""
+	}
+
+	if size == "-" {
+		size = "0"
+	}
+
+	return []string{
+		ip, user, timestamp, method, path, protocol, status, size,
+		unescapeLogString(match[7]), unescapeLogString(match[8]),
+	}
+}
+
+// Undo the escaping of quotes and backslashes in quoted fields
+func unescapeLogString(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(str)
+}
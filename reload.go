@@ -0,0 +1,183 @@
+package vxsv
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// How often a watched file is checked for changes
+const ReloadPollInterval = time.Second
+
+// Loader reads a fresh copy of a table from wherever it came from.
+type Loader func() (*TabularData, error)
+
+// EnableReload allows the table to be reloaded on demand using load. If path
+// isn't empty, the file is also watched and reloaded whenever it changes.
+func (ui *UI) EnableReload(path string, load Loader) {
+	ui.loader = load
+	ui.watchPath = path
+}
+
+// Poll the file's size and modification time, and ask the event loop to
+// reload once it has changed and then settled.
+func (ui *UI) watchFile(path string) {
+	var pending os.FileInfo
+	last, _ := os.Stat(path)
+
+	for {
+		time.Sleep(ReloadPollInterval)
+
+		// The file may be in the middle of being replaced
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if sameFileInfo(last, info) {
+			pending = nil
+			continue
+		}
+
+		// Give whoever is writing the file a chance to finish first
+		if !sameFileInfo(pending, info) {
+			pending = info
+			continue
+		}
+
+		last, pending = info, nil
+
+		select {
+		case ui.reloads <- struct{}{}:
+		default:
+		}
+
+		termbox.Interrupt()
+	}
+}
+
+func sameFileInfo(a, b os.FileInfo) bool {
+	return a != nil && b != nil && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+func (ui *UI) reload() {
+	data, err := ui.loader()
+	if err != nil {
+		ui.pushErrorPopup("Failed to reload", err)
+		return
+	}
+
+	ui.replaceData(data)
+}
+
+// Swap in a freshly loaded table, carrying over the filter, sort order,
+// column display settings and scroll position.
+func (ui *UI) replaceData(data *TabularData) {
+	loaded := data
+
+	// A newer copy replaces one still waiting to be shown
+	if pending := ui.pendingReload; pending != nil && pending != loaded && pending.Close != nil {
+		pending.Close()
+	}
+
+	ui.pendingReload = nil
+
+	// Stay on the same table, if it's still there
+	if len(ui.tables) > 1 {
+		current := ui.tables[ui.tableIdx].Table
+
+		for _, table := range loaded.Tables {
+			if table.Table == current {
+				data = table
+			}
+		}
+	}
+
+	// Or on the same result set, once the new copy has read that far. The
+	// old copy is shown until then.
+	resultIdx := 0
+	if results := loaded.Results; results != nil && ui.results != nil && ui.tableIdx < ui.resultCount {
+		loading := results.Loading()
+
+		if tables := results.Tables(); ui.tableIdx < len(tables) {
+			data, resultIdx = tables[ui.tableIdx], ui.tableIdx
+		} else if loading {
+			ui.pendingReload = loaded
+			ui.watchResults(results)
+			return
+		}
+	}
+
+	// Fall back to the first table, which has always been read
+	var openErr error
+	if err := data.open(); err != nil {
+		openErr = fmt.Errorf("%s: %v", data.Table, err)
+		data = loaded
+	}
+
+	// Stop reading the old copy, which may still be loading or following
+	if ui.closeInput != nil {
+		ui.closeInput()
+	}
+
+	ui.closeInput = loaded.Close
+	ui.name = loaded.Name
+	ui.source = loaded.Source
+	ui.following = loaded.Follow
+	ui.setTables(loaded.Tables, data)
+	ui.setResults(loaded.Results, resultIdx)
+	ui.watchResults(ui.results)
+
+	store := data.rowStore()
+
+	columns := data.Columns
+	sameLayout := len(columns) == len(ui.columns)
+
+	for i := range columns {
+		if j := ui.columnIndex(columns[i].Name); j != -1 {
+			columns[i].Display = ui.columns[j].Display
+			columns[i].Pinned = ui.columns[j].Pinned
+			columns[i].Highlight = ui.columns[j].Highlight
+		}
+
+		if sameLayout && columns[i].Name != ui.columns[i].Name {
+			sameLayout = false
+		}
+	}
+
+	// Any open mode may be holding on to a column index which no longer
+	// means the same thing.
+	if !sameLayout {
+		for i := range columns {
+			columns[i].Highlight = false
+		}
+
+		ui.switchToDefault()
+	}
+
+	ui.null = data.Null
+	ui.columns = columns
+	ui.rows = store
+	ui.rowCount = 0
+	ui.extraColumns = 0
+	ui.loading = true
+
+	var filterErr error
+	if _, ok := ui.filter.(EmptyFilter); !ok {
+		if ui.filter, filterErr = ui.parseFilter(ui.filter.String()); filterErr != nil {
+			ui.filter = EmptyFilter{}
+		}
+	}
+
+	ui.resetMatches()
+	ui.syncRows()
+	ui.watchRows()
+
+	if openErr != nil {
+		ui.pushErrorPopup("Failed to reload", openErr)
+	} else if filterErr != nil {
+		ui.pushErrorPopup("Filter no longer applies after reload", filterErr)
+	}
+}
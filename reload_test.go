@@ -0,0 +1,106 @@
+package vxsv
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestReloadShorterFileWithRowSelectOpen(t *testing.T) {
+	columns := func() []Column { return []Column{{Name: "name"}, {Name: "value"}} }
+
+	ui := NewUI(&TabularData{
+		Columns: columns(),
+		Rows:    [][]string{{"ant", "1"}, {"bee", "2"}, {"cat", "3"}, {"dog", "4"}},
+	})
+
+	ui.pushHandler(&HandlerRowSelect{HandlerDefault{ui}, 3})
+
+	ui.replaceData(&TabularData{
+		Columns: columns(),
+		Rows:    [][]string{{"eel", "5"}, {"fox", "6"}},
+	})
+
+	ui.activeHandler().HandleKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+
+	popup, ok := ui.activeHandler().(*HandlerPopup)
+	if !ok {
+		t.Fatalf("active handler is %T, want the expanded row popup", ui.activeHandler())
+	} else if content := strings.Join(popup.content, "\n"); !strings.Contains(content, `"fox"`) {
+		t.Errorf("expanded the wrong row:\n%s", content)
+	}
+
+	// Nothing to expand once every row has gone
+	ui.popHandler()
+	ui.replaceData(&TabularData{Columns: columns()})
+	ui.activeHandler().HandleKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+
+	if _, ok := ui.activeHandler().(*HandlerRowSelect); !ok {
+		t.Errorf("active handler is %T, want row select to stay open", ui.activeHandler())
+	}
+}
+
+func TestReloadKeepsResultSet(t *testing.T) {
+	first := " a \n---\n 1\n(1 row)\n\n"
+	second := " b \n---\n 2\n(1 row)\n\n"
+
+	read := func(input io.Reader) *TabularData {
+		data, err := StreamPSQLTable(input, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data
+	}
+
+	data := read(strings.NewReader(first + second))
+	data.Results.wait()
+
+	ui := NewUI(data)
+	ui.syncResults()
+	ui.showTable(1)
+
+	// Until the new copy has read the second result set, the old one stays
+	reader, writer := io.Pipe()
+	go writer.Write([]byte(first))
+
+	ui.replaceData(read(reader))
+
+	if ui.pendingReload == nil {
+		t.Fatal("reload wasn't left pending")
+	} else if ui.tables[ui.tableIdx] != data.Results.Tables()[1] {
+		t.Errorf("showing %q, want the old second result set", ui.tables[ui.tableIdx].Table)
+	}
+
+	go func() {
+		writer.Write([]byte(second))
+		writer.Close()
+	}()
+
+	ui.pendingReload.Results.wait()
+	ui.replaceData(ui.pendingReload)
+
+	if ui.pendingReload != nil {
+		t.Error("reload is still pending")
+	}
+
+	if ui.tableIdx != 1 || ui.tables[1] == data.Results.Tables()[1] {
+		t.Errorf("showing table %d, want the new second result set", ui.tableIdx)
+	} else if name := ui.columns[0].Name; name != "b" {
+		t.Errorf("column = %q, want %q", name, "b")
+	}
+
+	// Falls back to the first when there's no longer a second
+	ui.replaceData(read(strings.NewReader(first)))
+
+	if ui.pendingReload != nil {
+		ui.pendingReload.Results.wait()
+		ui.replaceData(ui.pendingReload)
+	}
+
+	if ui.tableIdx != 0 || len(ui.tables) != 1 {
+		t.Errorf("showing table %d of %d, want the only one", ui.tableIdx, len(ui.tables))
+	}
+}
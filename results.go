@@ -0,0 +1,222 @@
+// Inputs holding several result sets, such as the output of a psql script.
+
+package vxsv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// ResultSets holds every table found in the output of a SQL client, along
+// with the text printed around them, such as notices, timings and command
+// tags like "INSERT 0 1". Tables after the first are added while the input
+// is read in the background, each once the one before it has loaded.
+type ResultSets struct {
+	loadState
+
+	tables   []*TabularData
+	messages []string
+}
+
+func newResultSets() *ResultSets {
+	return &ResultSets{loadState: newLoadState(true)}
+}
+
+// Tables lists the tables found so far, in the order they were printed.
+func (r *ResultSets) Tables() []*TabularData {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.tables[:len(r.tables):len(r.tables)]
+}
+
+// Messages lists the lines of text which weren't part of any table.
+func (r *ResultSets) Messages() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.messages[:len(r.messages):len(r.messages)]
+}
+
+func (r *ResultSets) add(data *TabularData) {
+	r.mu.Lock()
+	if data.Table == "" {
+		data.Table = fmt.Sprintf("result %d", len(r.tables)+1)
+	}
+
+	data.Results = r
+	r.tables = append(r.tables, data)
+	r.mu.Unlock()
+
+	r.notify()
+}
+
+func (r *ResultSets) addMessages(lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	r.messages = append(r.messages, lines...)
+	r.mu.Unlock()
+
+	r.notify()
+}
+
+// A table found in a SQL client's output. load reads its rows into its
+// store, then skips over any past the row limit to reach whatever follows.
+type sqlResult struct {
+	data *TabularData
+	load func()
+}
+
+// Set up loading a table's rows from next.
+func newSQLResult(data *TabularData, next rowSource, count int64) *sqlResult {
+	store := newLoadingStore()
+	data.Store = store
+
+	return &sqlResult{data, func() {
+		store.load(next, count)
+
+		for {
+			if _, err := next(); err != nil {
+				return
+			}
+		}
+	}}
+}
+
+// A table printed without a header, because it has no rows.
+func emptySQLResult() *sqlResult {
+	return &sqlResult{&TabularData{Store: NewMemoryStore(nil)}, func() {}}
+}
+
+// Find every table in a SQL client's output, using read to find the next
+// one and add the text before it to results. The first table is returned
+// once it has been found, and the rest are read in the background.
+func streamSQLResults(client string, results *ResultSets, read func() (*sqlResult, error)) (*TabularData, error) {
+	first, err := read()
+	if err != nil {
+		return nil, err
+	} else if first == nil {
+		return nil, fmt.Errorf("No table found in %s output", client)
+	}
+
+	results.add(first.data)
+
+	go func() {
+		result := first
+		for result != nil {
+			result.load()
+
+			if result, err = read(); result != nil {
+				results.add(result.data)
+			}
+		}
+
+		if err != nil {
+			results.addMessages(fmt.Sprintf("Stopped reading %s output: %v", client, err))
+		}
+
+		results.finish(nil)
+	}()
+
+	return first.data, nil
+}
+
+// Keep track of the result sets in the input, showing the one at idx, which
+// must already have been read.
+func (ui *UI) setResults(results *ResultSets, idx int) {
+	ui.results = results
+	ui.resultCount = 1
+
+	if results != nil && idx > 0 {
+		tables := results.Tables()[:idx+1]
+		ui.setTables(tables, tables[idx])
+		ui.resultCount = len(tables)
+	}
+}
+
+// Watch results for new result sets, no longer waking up for those of an
+// input which has since been replaced.
+func (ui *UI) watchResults(results *ResultSets) {
+	if ui.stopResults != nil {
+		close(ui.stopResults)
+		ui.stopResults = nil
+	}
+
+	if results != nil {
+		ui.stopResults = make(chan struct{})
+		go ui.watchResultSets(results, ui.stopResults)
+	}
+}
+
+// Wake up the event loop whenever another result set or message turns up,
+// until stop is closed.
+func (ui *UI) watchResultSets(results *ResultSets, stop <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-results.Updates():
+			termbox.Interrupt()
+			if !ok {
+				return
+			}
+
+			time.Sleep(LoadRefreshInterval)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Add any result sets read since the last sync to the tables to switch
+// between, staying on the table being shown.
+func (ui *UI) syncResults() {
+	if ui.results == nil {
+		return
+	}
+
+	tables := ui.results.Tables()
+	for _, table := range tables[ui.resultCount:] {
+		ui.tables = append(ui.tables, table)
+		ui.views = append(ui.views, nil)
+	}
+
+	ui.resultCount = len(tables)
+}
+
+// Most messages to list, like MaxProblemsShown
+const MaxMessagesShown = 1000
+
+func (ui *UI) pushMessagesPopup() {
+	var messages []string
+	if ui.results != nil {
+		messages = ui.results.Messages()
+	}
+
+	if len(messages) == 0 {
+		ui.pushHandler(NewPopup(ui, "No messages were printed around the tables."))
+		return
+	}
+
+	lines := []string{
+		"",
+		"  [ messages ]",
+		"  ------------",
+		"",
+	}
+
+	for i, message := range messages {
+		if i == MaxMessagesShown {
+			lines = append(lines, "", fmt.Sprintf("  ... and %d more", len(messages)-i))
+			break
+		}
+
+		lines = append(lines, "  "+message)
+	}
+
+	ui.pushHandler(NewPopup(ui, strings.Join(lines, "\n")))
+}
@@ -0,0 +1,223 @@
+// Guessing the format of an input from a sample of it.
+
+package vxsv
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// Input formats which can be recognized by SniffFormat
+const (
+	FormatCSV   = "csv"
+	FormatPSQL  = "psql"
+	FormatMySQL = "mysql"
+	FormatJSON  = "json"
+	FormatGrid  = "grid"
+	FormatHTML  = "html"
+
+	FormatLogfmt    = "logfmt"
+	FormatAccessLog = "access log"
+
+	// Never guessed, only given with --columns and --widths
+	FormatAligned    = "aligned"
+	FormatFixedWidth = "fixed width"
+
+	FormatSpreadsheet = "spreadsheet"
+	FormatParquet     = "parquet"
+	FormatArrow       = "arrow"
+	FormatSQLite      = "sqlite"
+)
+
+// Delimiters to try, in order of preference when several fit equally well
+var SniffDelimiters = []rune{',', '\t', ';', '|'}
+
+// Quote characters to try, in order of preference
+var SniffQuotes = []rune{'"', '\''}
+
+// Maximum number of records to look at when scoring a dialect
+const sniffRecords = 100
+
+var (
+	psqlSeparatorRegex  = regexp.MustCompile(`^(-+(\+-+)*|─+(┼─+)*)$`)
+	mysqlSeparatorRegex = regexp.MustCompile(`^\+(-+\+)+$`)
+
+	// An object, or an array of objects or arrays
+	jsonStartRegex = regexp.MustCompile(`^\s*(\{|\[\s*[\[{\]])`)
+
+	// At least two pairs, so a lone "a=b" in a CSV isn't taken for logfmt
+	logfmtRegex = regexp.MustCompile(`^[^\s="]+=("(?:[^"\\]|\\.)*"|\S*)(\s+[^\s="]+(=("(?:[^"\\]|\\.)*"|\S*))?)+$`)
+
+	// A page, or a bare table
+	htmlStartRegex = regexp.MustCompile(`(?i)^\s*(<!--.*?-->\s*)*<(!doctype html|html|table)\b`)
+)
+
+// InputFormat is a guess at how an input should be parsed
+type InputFormat struct {
+	Format string
+
+	// Only set for FormatCSV
+	CSV CSVOptions
+}
+
+// Binary formats, told apart by the magic number they start with
+var binaryFormats = []struct {
+	format string
+	magic  []byte
+}{
+	{FormatSpreadsheet, []byte("PK\x03\x04")},
+	{FormatParquet, []byte("PAR1")},
+	{FormatArrow, []byte("ARROW1")},
+	{FormatSQLite, []byte("SQLite format 3\x00")},
+}
+
+// SniffBinaryFormat checks whether reader holds one of the binary formats,
+// which have to be recognized before the input is decoded as text. The
+// format is empty for anything else. The returned reader still includes
+// the sample.
+func SniffBinaryFormat(reader io.Reader) (io.Reader, string, error) {
+	buffered, sample, err := peekSample(reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, binary := range binaryFormats {
+		if bytes.HasPrefix(sample, binary.magic) {
+			return buffered, binary.format, nil
+		}
+	}
+
+	return buffered, "", nil
+}
+
+// SniffFormat looks at the first few KB of reader to guess what kind of
+// table it contains, and for delimited files fills in whichever of the
+// delimiter and quote character aren't already set in opts. Giving a
+// delimiter means the input is known to be delimited. The returned reader
+// still includes the sample.
+func SniffFormat(reader io.Reader, opts CSVOptions) (io.Reader, InputFormat, error) {
+	buffered, sample, err := peekSample(reader)
+	if err != nil {
+		return nil, InputFormat{}, err
+	}
+
+	format := InputFormat{Format: FormatCSV}
+	if opts.Delimiter == 0 {
+		format.Format = sniffTableFormat(sample)
+	}
+
+	if format.Format == FormatCSV {
+		format.CSV = SniffCSVOptions(sample, opts)
+	}
+
+	return buffered, format, nil
+}
+
+func sniffTableFormat(sample []byte) string {
+	if jsonStartRegex.Match(sample) {
+		return FormatJSON
+	} else if htmlStartRegex.Match(sample) {
+		return FormatHTML
+	}
+
+	lines := bytes.SplitN(sample, []byte("\n"), 3)
+	if len(lines) < 3 {
+		return FormatCSV
+	}
+
+	first := bytes.TrimSpace(lines[0])
+	second := bytes.TrimSpace(lines[1])
+
+	switch {
+	case mysqlSeparatorRegex.Match(first) && bytes.HasPrefix(second, []byte("|")):
+		return FormatMySQL
+	case mysqlRecordRegex.Match(first):
+		return FormatMySQL
+	case psqlRecordRegex.Match(first):
+		return FormatPSQL
+	case psqlSeparatorRegex.Match(second):
+		return FormatPSQL
+	case isTableRule(string(first)) && bytes.ContainsAny(second, "|"+boxSeparators):
+		return FormatGrid
+	case bytes.ContainsAny(first, "|"+boxSeparators) && isTableRule(string(second)):
+		return FormatGrid
+	case accessLogRegex.Match(first):
+		return FormatAccessLog
+	case logfmtRegex.Match(first):
+		return FormatLogfmt
+	}
+
+	return FormatCSV
+}
+
+// SniffCSVOptions picks the delimiter and quote character which split the
+// sample into the most consistent number of columns. Any that are already
+// set in opts are kept as they are, as are the other options.
+func SniffCSVOptions(sample []byte, opts CSVOptions) CSVOptions {
+	// The sample probably stops part way through a line
+	if idx := bytes.LastIndexByte(sample, '\n'); idx != -1 {
+		sample = sample[:idx+1]
+	}
+
+	delimiters, quotes := SniffDelimiters, SniffQuotes
+	if opts.Delimiter != 0 {
+		delimiters = []rune{opts.Delimiter}
+	}
+
+	if opts.Quote != 0 {
+		quotes = []rune{opts.Quote}
+	}
+
+	best := opts.withDefaults()
+	bestScore := 0.0
+
+	for _, delimiter := range delimiters {
+		for _, quote := range quotes {
+			candidate := opts
+			candidate.Delimiter, candidate.Quote = delimiter, quote
+
+			if score := scoreCSVOptions(sample, candidate); score > bestScore {
+				best, bestScore = candidate.withDefaults(), score
+			}
+		}
+	}
+
+	return best
+}
+
+// Score how well a dialect fits the sample: the fraction of records which
+// have the most common number of columns, or 0 if that's a single column.
+func scoreCSVOptions(sample []byte, opts CSVOptions) float64 {
+	csv := newCSVReader(bytes.NewReader(sample), opts)
+	counts := make(map[int]int)
+
+	var total int
+	for total < sniffRecords {
+		record, err := csv.Read()
+
+		// A quote left open is most likely a field cut off by the end of
+		// the sample, but any other error rules this dialect out.
+		if err == io.EOF || (err != nil && total > 0 && csv.atEOF()) {
+			break
+		} else if err != nil {
+			return 0
+		}
+
+		counts[len(record)]++
+		total++
+	}
+
+	var mode int
+	for columns, count := range counts {
+		if count > counts[mode] || (count == counts[mode] && columns > mode) {
+			mode = columns
+		}
+	}
+
+	if total == 0 || mode < 2 {
+		return 0
+	}
+
+	return float64(counts[mode]) / float64(total)
+}
@@ -0,0 +1,639 @@
+// Reading Excel and OpenDocument spreadsheets.
+
+package vxsv
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// One sheet of a spreadsheet, before it's been turned into a table
+type sheet struct {
+	name string
+	rows [][]string
+}
+
+// ReadSpreadsheet reads an Excel (.xlsx) or OpenDocument (.ods) spreadsheet,
+// with each sheet becoming one of the returned table's Tables. Formulas are
+// shown as the values last calculated for them, and dates as ISO 8601.
+func ReadSpreadsheet(reader io.Reader, readHeader bool, count int64) (*TabularData, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	var sheets []sheet
+	var format string
+
+	switch {
+	case findZipFile(archive, "xl/workbook.xml") != nil:
+		format = "xlsx spreadsheet"
+		sheets, err = readXLSX(archive)
+	case findZipFile(archive, "content.xml") != nil:
+		format = "ods spreadsheet"
+		sheets, err = readODS(archive)
+	default:
+		return nil, errors.New("Not an xlsx or ods spreadsheet")
+	}
+
+	if err != nil {
+		return nil, err
+	} else if len(sheets) == 0 {
+		return nil, errors.New("Spreadsheet doesn't have any sheets")
+	}
+
+	tables := make([]*TabularData, len(sheets))
+	for i, sheet := range sheets {
+		tables[i] = sheet.table(readHeader, count)
+		tables[i].Source.Format = format
+	}
+
+	data := tables[0]
+	if len(tables) > 1 {
+		data.Tables = tables
+	}
+
+	return data, nil
+}
+
+func (s sheet) table(readHeader bool, count int64) *TabularData {
+	rows := s.rows
+
+	numColumns := 0
+	for _, row := range rows {
+		numColumns = max(numColumns, len(row))
+	}
+
+	data := &TabularData{Table: s.name, Columns: make([]Column, numColumns)}
+
+	for i := range data.Columns {
+		name := fmt.Sprintf("[%d]", i)
+		if readHeader && len(rows) > 0 && i < len(rows[0]) && rows[0][i] != "" {
+			name = rows[0][i]
+		}
+
+		data.Columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	if readHeader && len(rows) > 0 {
+		rows = rows[1:]
+	}
+
+	if int64(len(rows)) > count {
+		rows = rows[:count]
+	}
+
+	for i, row := range rows {
+		for len(row) < numColumns {
+			row = append(row, "")
+		}
+
+		rows[i] = row
+		fitColumns(data.Columns, row)
+	}
+
+	data.Rows = rows
+	return data
+}
+
+// Set a cell, growing the row as needed
+func setCell(row []string, idx int, value string) []string {
+	for len(row) <= idx {
+		row = append(row, "")
+	}
+
+	row[idx] = value
+	return row
+}
+
+// Drop empty rows from the end of a sheet, which often have formatting but
+// nothing else.
+func trimEmptyRows(rows [][]string) [][]string {
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+
+	return rows
+}
+
+func findZipFile(archive *zip.Reader, name string) *zip.File {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file
+		}
+	}
+
+	return nil
+}
+
+// Decode an XML file in the archive into v, leaving v alone if the file
+// doesn't exist.
+func unmarshalZipFile(archive *zip.Reader, name string, v interface{}) error {
+	file := findZipFile(archive, name)
+	if file == nil {
+		return nil
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return xml.NewDecoder(reader).Decode(v)
+}
+
+// Display form of a number, rounded to the 15 significant digits Excel
+// shows so that floating point noise is hidden.
+func formatNumber(value string) string {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(f, 'g', 15, 64)
+	}
+
+	return value
+}
+
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// Either plain text, or runs of differently formatted text
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	text := t.Text
+	for _, run := range t.Runs {
+		text += run.Text
+	}
+
+	return text
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumberFormats []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+
+	CellFormats []struct {
+		NumberFormat int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// Number formats built into Excel which show dates or times
+func isBuiltinDateFormat(id int) bool {
+	return (id >= 14 && id <= 22) || (id >= 27 && id <= 36) || (id >= 45 && id <= 47) || (id >= 50 && id <= 58)
+}
+
+// Literal text, colors and the like in a format code
+var formatLiteralRegex = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+
+func isDateFormatCode(code string) bool {
+	code = formatLiteralRegex.ReplaceAllString(strings.ToLower(code), "")
+	return strings.ContainsAny(code, "dmyhs")
+}
+
+// Everything needed to make sense of the cells of an xlsx sheet
+type xlsxContext struct {
+	strings    []string
+	dateStyles []bool
+	date1904   bool
+}
+
+func readXLSX(archive *zip.Reader) ([]sheet, error) {
+	var workbook xlsxWorkbook
+	var relationships xlsxRelationships
+	var sharedStrings xlsxSharedStrings
+	var styles xlsxStyles
+
+	for name, v := range map[string]interface{}{
+		"xl/workbook.xml":            &workbook,
+		"xl/_rels/workbook.xml.rels": &relationships,
+		"xl/sharedStrings.xml":       &sharedStrings,
+		"xl/styles.xml":              &styles,
+	} {
+		if err := unmarshalZipFile(archive, name, v); err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %v", name, err)
+		}
+	}
+
+	ctx := &xlsxContext{date1904: workbook.Properties.Date1904}
+
+	for _, item := range sharedStrings.Items {
+		ctx.strings = append(ctx.strings, item.String())
+	}
+
+	dateFormats := make(map[int]bool)
+	for _, format := range styles.NumberFormats {
+		dateFormats[format.ID] = isDateFormatCode(format.Code)
+	}
+
+	for _, format := range styles.CellFormats {
+		id := format.NumberFormat
+		isDate, custom := dateFormats[id]
+
+		ctx.dateStyles = append(ctx.dateStyles, isDate || (!custom && isBuiltinDateFormat(id)))
+	}
+
+	targets := make(map[string]string)
+	for _, rel := range relationships.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+
+	var sheets []sheet
+	for _, ws := range workbook.Sheets {
+		file := findZipFile(archive, targets[ws.ID])
+		if file == nil {
+			return nil, fmt.Errorf("Sheet \"%s\" is missing", ws.Name)
+		}
+
+		rows, err := ctx.readSheet(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read sheet \"%s\": %v", ws.Name, err)
+		}
+
+		sheets = append(sheets, sheet{name: ws.Name, rows: rows})
+	}
+
+	return sheets, nil
+}
+
+// A cell being read, along with its attributes
+type xlsxCell struct {
+	ref        string
+	cellType   string
+	style      int
+	value      strings.Builder
+	inline     strings.Builder
+	inPhonetic bool
+}
+
+// Stream through a worksheet's XML, which can be much larger than the table
+// it holds.
+func (ctx *xlsxContext) readSheet(file *zip.File) ([][]string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoder := xml.NewDecoder(reader)
+
+	var rows [][]string
+	var row []string
+	var cell *xlsxCell
+	var text *strings.Builder
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "row":
+				// Rows which are entirely empty may be left out
+				if num, err := strconv.Atoi(xmlAttr(token, "r")); err == nil {
+					for len(rows) < num-1 {
+						rows = append(rows, nil)
+					}
+				}
+
+				row = nil
+			case "c":
+				cell = &xlsxCell{ref: xmlAttr(token, "r"), cellType: xmlAttr(token, "t")}
+				cell.style, _ = strconv.Atoi(xmlAttr(token, "s"))
+			case "v":
+				if cell != nil {
+					text = &cell.value
+				}
+			case "t":
+				if cell != nil && !cell.inPhonetic {
+					text = &cell.inline
+				}
+			case "rPh":
+				if cell != nil {
+					cell.inPhonetic = true
+				}
+			}
+		case xml.CharData:
+			if text != nil {
+				text.Write(token)
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "v", "t":
+				text = nil
+			case "rPh":
+				if cell != nil {
+					cell.inPhonetic = false
+				}
+			case "c":
+				if value := ctx.cellValue(cell); value != "" {
+					idx := len(row)
+					if col, ok := columnRefIndex(cell.ref); ok {
+						idx = col
+					}
+
+					row = setCell(row, idx, value)
+				}
+
+				cell = nil
+			case "row":
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	return trimEmptyRows(rows), nil
+}
+
+func (ctx *xlsxContext) cellValue(cell *xlsxCell) string {
+	value := cell.value.String()
+
+	switch cell.cellType {
+	case "s":
+		if idx, err := strconv.Atoi(value); err == nil && idx >= 0 && idx < len(ctx.strings) {
+			return ctx.strings[idx]
+		}
+	case "inlineStr":
+		return cell.inline.String()
+	case "b":
+		if value == "1" {
+			return "TRUE"
+		}
+
+		return "FALSE"
+	case "str", "e", "d":
+		return value
+	default:
+		if cell.style >= 0 && cell.style < len(ctx.dateStyles) && ctx.dateStyles[cell.style] {
+			if serial, err := strconv.ParseFloat(value, 64); err == nil {
+				return excelDate(serial, ctx.date1904)
+			}
+		}
+
+		return formatNumber(value)
+	}
+
+	return value
+}
+
+// Column index of a cell reference such as "AB12"
+func columnRefIndex(ref string) (int, bool) {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+
+		col = col*26 + int(ch-'A'+1)
+	}
+
+	return col - 1, col > 0
+}
+
+// Convert a date stored as the number of days since Excel's epoch. Serials
+// below one are times of day, and whole numbers are plain dates.
+func excelDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	timeOnly := serial < 1 && !date1904
+
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if serial < 60 {
+		// Excel believes 1900 was a leap year
+		serial++
+	}
+
+	seconds := math.Round(serial * 24 * 60 * 60)
+	date := epoch.Add(time.Duration(seconds) * time.Second)
+
+	switch {
+	case timeOnly:
+		return date.Format("15:04:05")
+	case date.Hour() == 0 && date.Minute() == 0 && date.Second() == 0:
+		return date.Format("2006-01-02")
+	}
+
+	return date.Format("2006-01-02T15:04:05")
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// Stream through an OpenDocument spreadsheet's content, where every sheet
+// is a table:table element.
+func readODS(archive *zip.Reader) ([]sheet, error) {
+	file := findZipFile(archive, "content.xml")
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoder := xml.NewDecoder(reader)
+
+	var sheets []sheet
+	var current *sheet
+	var row []string
+	var rowRepeat, cellRepeat int
+	var cellValue string
+	var text *strings.Builder
+	var annotation int
+
+	// Runs of empty rows and cells are only filled in once something
+	// follows them, so the million empty rows padding out a sheet don't
+	// end up in the table.
+	var emptyRows, emptyCells int
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "table":
+				sheets = append(sheets, sheet{name: xmlAttr(token, "name")})
+				current = &sheets[len(sheets)-1]
+				emptyRows = 0
+			case "table-row":
+				row, emptyCells = nil, 0
+				rowRepeat = repeatCount(xmlAttr(token, "number-rows-repeated"))
+			case "table-cell", "covered-table-cell":
+				cellRepeat = repeatCount(xmlAttr(token, "number-columns-repeated"))
+				cellValue = odsCellValue(token)
+				text = nil
+
+				if cellValue == "" {
+					text = &strings.Builder{}
+				}
+			case "annotation":
+				annotation++
+			case "p":
+				// Paragraphs after the first start a new line
+				if text != nil && annotation == 0 && text.Len() > 0 {
+					text.WriteByte('\n')
+				}
+			case "s":
+				if text != nil && annotation == 0 {
+					text.WriteString(strings.Repeat(" ", repeatCount(xmlAttr(token, "c"))))
+				}
+			case "tab":
+				if text != nil && annotation == 0 {
+					text.WriteByte('\t')
+				}
+			case "line-break":
+				if text != nil && annotation == 0 {
+					text.WriteByte('\n')
+				}
+			}
+		case xml.CharData:
+			if text != nil && annotation == 0 {
+				text.Write(token)
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "annotation":
+				annotation--
+			case "table-cell", "covered-table-cell":
+				if text != nil {
+					cellValue = text.String()
+					text = nil
+				}
+
+				if cellValue == "" {
+					emptyCells += cellRepeat
+					continue
+				}
+
+				for ; emptyCells > 0; emptyCells-- {
+					row = append(row, "")
+				}
+
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, cellValue)
+				}
+			case "table-row":
+				if current == nil {
+					continue
+				} else if len(row) == 0 {
+					emptyRows += rowRepeat
+					continue
+				}
+
+				for ; emptyRows > 0; emptyRows-- {
+					current.rows = append(current.rows, nil)
+				}
+
+				for i := 0; i < rowRepeat; i++ {
+					current.rows = append(current.rows, row)
+				}
+			case "table":
+				current = nil
+			}
+		}
+	}
+
+	return sheets, nil
+}
+
+func repeatCount(attr string) int {
+	if n, err := strconv.Atoi(attr); err == nil && n > 0 {
+		return n
+	}
+
+	return 1
+}
+
+// Typed cells keep their value in an attribute, which unlike the displayed
+// text isn't affected by formatting. Text cells return an empty string.
+func odsCellValue(cell xml.StartElement) string {
+	switch xmlAttr(cell, "value-type") {
+	case "float", "percentage", "currency":
+		return formatNumber(xmlAttr(cell, "value"))
+	case "date":
+		return strings.TrimSuffix(xmlAttr(cell, "date-value"), "T00:00:00")
+	case "time":
+		return odsTime(xmlAttr(cell, "time-value"))
+	case "boolean":
+		return strings.ToUpper(xmlAttr(cell, "boolean-value"))
+	}
+
+	return ""
+}
+
+var odsDurationRegex = regexp.MustCompile(`^-?PT?(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?$`)
+
+// Times are stored as durations, e.g. PT13H45M00S
+func odsTime(duration string) string {
+	match := odsDurationRegex.FindStringSubmatch(duration)
+	if match == nil {
+		return duration
+	}
+
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+
+	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, int(math.Round(seconds)))
+}
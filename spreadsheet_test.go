@@ -0,0 +1,25 @@
+package vxsv
+
+import "testing"
+
+func TestExcelDate(t *testing.T) {
+	tests := []struct {
+		serial   float64
+		date1904 bool
+		want     string
+	}{
+		{0.5, false, "12:00:00"},
+		{0.25, false, "06:00:00"},
+		{1, false, "1900-01-01"},
+		{59, false, "1900-02-28"},
+		{61, false, "1900-03-01"},
+		{43831.75, false, "2020-01-01T18:00:00"},
+		{0, true, "1904-01-01"},
+	}
+
+	for _, test := range tests {
+		if got := excelDate(test.serial, test.date1904); got != test.want {
+			t.Errorf("excelDate(%v, %v) = %q, want %q", test.serial, test.date1904, got, test.want)
+		}
+	}
+}
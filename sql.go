@@ -3,46 +3,344 @@ package vxsv
 import (
 	"bufio"
 	"io"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
-// Parses Postgres output format:
+// Footer psql prints after a table, e.g. (100 rows)
+var psqlFooterRegex = regexp.MustCompile(`^\(\d+ rows?\)$`)
+
+// Lines psql draws either side of each row with \pset border 2, in the ascii
+// and unicode line styles
+const psqlRowBorders = "|│"
+
+// Markers psql leaves in a cell's padding when its value carries on to the
+// next line, in the ascii and unicode line styles
+const (
+	psqlNewlineMarkers = "+↵"
+	psqlWrapMarkers    = ".…"
+)
+
+// Parses Postgres output format, with any of \pset border 0, 1 or 2 and the
+// ascii or unicode line style:
 //
-//  colA | colB | colC
-// ------+------+-----
-//  foo  | bar  | baz
-//  foo2 | bar2 | baz2
-// (2 rows)
+//	 colA | colB | colC    colA colB colC    ┌──────┬──────┬──────┐
+//	------+------+-----    ---- ---- ----    │ colA │ colB │ colC │
+//	 foo  | bar  | baz     foo  bar  baz     ├──────┼──────┼──────┤
+//	 foo2 | bar2 | baz2    foo2 bar2 baz2    │ foo  │ bar  │ baz  │
+//	(2 rows)               (2 rows)          └──────┴──────┴──────┘
 func ReadPSQLTable(reader io.Reader, count int64) (*TabularData, error) {
-	scanner := bufio.NewScanner(reader)
-	scanner.Scan()
+	return ReadPSQLTableWithOptions(reader, PSQLOptions{}, count)
+}
 
-	columnString := scanner.Text()
-	columns := parseColumns(columnString)
+// PSQLOptions describes how psql was set up when printing its output. The
+// zero value means psql's defaults.
+type PSQLOptions struct {
+	// What psql shows for null values, which is blank unless changed with
+	// \pset null. Cells holding it are shown distinctly.
+	Null string
+}
 
-	// Skip the horizontal line
-	scanner.Scan()
+// Like ReadPSQLTable, for output printed with the given psql settings.
+func ReadPSQLTableWithOptions(reader io.Reader, opts PSQLOptions, count int64) (*TabularData, error) {
+	data, err := StreamPSQLTableWithOptions(reader, opts, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
 
-	rows := [][]string{}
+// Like ReadPSQLTable, but loads rows into data.Store in the background.
+//
+// Columns are found from the rule under the header, so names and values
+// can contain "|", and are measured in display width as psql lines them up.
+// Values psql spread over several lines, whether they hold newlines or were
+// wrapped to fit the terminal, are joined back together.
+//
+// Output with several tables, such as from running a script, has the rest
+// read into data.Results after the first, along with anything else psql
+// printed such as notices and "INSERT 0 1".
+func StreamPSQLTable(reader io.Reader, count int64) (*TabularData, error) {
+	return StreamPSQLTableWithOptions(reader, PSQLOptions{}, count)
+}
+
+// Like StreamPSQLTable, for output printed with the given psql settings.
+func StreamPSQLTableWithOptions(reader io.Reader, opts PSQLOptions, count int64) (*TabularData, error) {
+	psql := &psqlReader{
+		lines:   newLineScanner(bufio.NewScanner(reader)),
+		results: newResultSets(),
+		null:    opts.Null,
+		count:   count,
+	}
+
+	return streamSQLResults("psql", psql.results, psql.next)
+}
+
+// Reads the tables in psql's output one after another.
+type psqlReader struct {
+	lines   *lineScanner
+	results *ResultSets
+	null    string
+	count   int64
+}
 
-	var i int64
-	for i = 0; i < count && scanner.Scan(); i++ {
-		// This is the last line that's printed, e.g. (100 rows)
-		if scanner.Text()[0] == '(' {
-			break
+// Read on to the next table, adding any other text on the way to results.
+// Returns nil once the input runs out.
+func (r *psqlReader) next() (*sqlResult, error) {
+	// Lines since the last blank one, which end with the header once the
+	// rule under it turns up
+	var above []string
+
+	for r.lines.scan() {
+		line := strings.TrimRight(r.lines.text, " \r")
+
+		switch {
+		case psqlRecordRegex.MatchString(line):
+			// Shown by \x, or \x auto when the table is too wide
+			r.results.addMessages(above...)
+
+			result, err := streamPSQLExpanded(r.lines, r.count)
+			if err != nil {
+				return nil, err
+			}
+
+			result.data.Null = r.null
+			return result, nil
+		case line == "":
+			r.results.addMessages(above...)
+			above = nil
+		case len(above) == 0 && psqlFooterRegex.MatchString(line):
+			// Expanded output with no records has nothing but the footer
+			return emptySQLResult(), nil
+		default:
+			if cells, ok := parseTableRule(line); ok && len(above) > 0 {
+				return r.table(above, line, cells), nil
+			}
+
+			above = append(above, r.lines.text)
+		}
+	}
+
+	r.results.addMessages(above...)
+	return nil, r.lines.scanner.Err()
+}
+
+// A table whose rule has just been read, with the lines above it.
+func (r *psqlReader) table(above []string, rule string, cells []cellBounds) *sqlResult {
+	// Border 2 draws a box around the table, with a rule above the header
+	// as well as under it
+	first, _ := utf8.DecodeRuneInString(rule)
+	boxed := first == '+' || first == '├'
+
+	header := above
+	if boxed {
+		header = make([]string, len(above))
+		for i, line := range above {
+			header[i] = trimPSQLBorder(line)
 		}
+	}
 
-		rows = append(rows, parseRow(columns, scanner.Text()))
+	// Border 0 has no padding, so with a single column there's no space
+	// between columns in the rule to tell it apart from border 1. Border 1
+	// always pads the header on the left, with "↵" under the unicode line
+	// style when a long name carries on.
+	if len(cells) == 1 && !strings.HasPrefix(header[len(header)-1], " ") &&
+		!strings.HasPrefix(header[len(header)-1], "↵") {
+		cells = unpaddedCells(cells)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	columns, start := psqlHeader(header, cells)
+	data := &TabularData{Columns: columns, Null: r.null}
+
+	if boxed && start > 0 && isTableRule(above[start-1]) {
+		start--
+	}
+
+	// psql centres a table's title above it, as in \d
+	if start > 0 && strings.HasPrefix(above[start-1], " ") {
+		start--
+		data.Table = strings.TrimSpace(above[start])
 	}
 
-	return &TabularData{
-		Columns: columns,
-		Rows:    rows,
-	}, nil
+	r.results.addMessages(above[:start]...)
+
+	next := func() ([]string, error) {
+		row := newPSQLRow(cells)
+
+		for r.lines.scan() {
+			// The table ends with the row count, or a blank line when the
+			// footer is turned off
+			line := strings.TrimRight(r.lines.text, " \r")
+			if line == "" || psqlFooterRegex.MatchString(line) {
+				break
+			}
+
+			if boxed {
+				// Skip over the bottom of the box to the footer
+				if border, _ := utf8.DecodeRuneInString(line); !strings.ContainsRune(psqlRowBorders, border) {
+					continue
+				}
+
+				line = trimPSQLBorder(line)
+			}
+
+			if row.add(line) {
+				return row.values(), nil
+			}
+		}
+
+		// A row cut off part way through is still worth showing
+		if row.started {
+			return row.values(), nil
+		}
+
+		return nil, scannerDone(r.lines.scanner)
+	}
+
+	return newSQLResult(data, next, r.count)
+}
+
+// Drop the right hand border of a line of a boxed table, so it isn't part
+// of the last cell. The left one is outside the first cell anyway.
+func trimPSQLBorder(line string) string {
+	line = strings.TrimRight(line, " \r")
+	if border, size := utf8.DecodeLastRuneInString(line); strings.ContainsRune(psqlRowBorders, border) {
+		return line[:len(line)-size]
+	}
+
+	return line
+}
+
+// Column names from the lines above the rule, and which of them the header
+// starts on. Long or multi-line names take up several lines, each of which
+// but the last has continuation markers.
+func psqlHeader(above []string, cells []cellBounds) ([]Column, int) {
+	first := len(above) - 1
+	for first > 0 && hasPSQLMarkers(above[first-1], cells) {
+		first--
+	}
+
+	header := newPSQLRow(cells)
+	for _, line := range above[first:] {
+		header.add(line)
+	}
+
+	columns := make([]Column, len(cells))
+	for i, name := range header.values() {
+		name = strings.ReplaceAll(name, "\n", " ")
+		columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	return columns, first
+}
+
+// A row of a psql table, which may be spread over several lines. Each cell
+// has a marker in its right hand padding when it carries on to the next
+// line: "+" or "↵" for a newline in the value, or "." or "…" where psql's
+// wrapped format broke a long value up.
+type psqlRow struct {
+	cells   []cellBounds
+	parts   []strings.Builder
+	markers []rune
+	started bool
+}
+
+func newPSQLRow(cells []cellBounds) *psqlRow {
+	return &psqlRow{
+		cells:   cells,
+		parts:   make([]strings.Builder, len(cells)),
+		markers: make([]rune, len(cells)),
+	}
+}
+
+// Add the next line of the row, returning whether the row is complete.
+func (r *psqlRow) add(line string) bool {
+	values, markers := splitPSQLLine(line, r.cells)
+	done := true
+
+	for i, value := range values {
+		switch {
+		case !r.started:
+			value = strings.TrimLeft(value, " ")
+		case strings.ContainsRune(psqlNewlineMarkers, r.markers[i]):
+			r.parts[i].WriteByte('\n')
+		case strings.ContainsRune(psqlWrapMarkers, r.markers[i]):
+		default:
+			// This cell finished on an earlier line
+			continue
+		}
+
+		if !strings.ContainsRune(psqlWrapMarkers, markers[i]) {
+			value = strings.TrimRight(value, " ")
+		}
+
+		r.parts[i].WriteString(value)
+
+		r.markers[i] = markers[i]
+		done = done && !isPSQLMarker(markers[i])
+	}
+
+	r.started = true
+	return done
+}
+
+func (r *psqlRow) values() []string {
+	row := make([]string, len(r.parts))
+	for i := range r.parts {
+		row[i] = r.parts[i].String()
+	}
+
+	return row
+}
+
+func isPSQLMarker(r rune) bool {
+	return r != 0 && strings.ContainsRune(psqlNewlineMarkers+psqlWrapMarkers, r)
+}
+
+func hasPSQLMarkers(line string, cells []cellBounds) bool {
+	_, markers := splitPSQLLine(line, cells)
+	for _, marker := range markers {
+		if isPSQLMarker(marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Contents of each cell on one line, leaving out the padding either side,
+// and what's in the right hand padding. The last cell runs on to the end of
+// the line.
+func splitPSQLLine(line string, cells []cellBounds) ([]string, []rune) {
+	values := make([]string, len(cells))
+	markers := make([]rune, len(cells))
+
+	var value strings.Builder
+	idx, col := 0, 0
+	last := len(cells) - 1
+
+	for _, r := range line {
+		for idx < last && col >= cells[idx].end {
+			values[idx] = value.String()
+			value.Reset()
+			idx++
+		}
+
+		cell := cells[idx]
+		switch {
+		case col == cell.end-1 && isPSQLMarker(r):
+			markers[idx] = r
+		case col > cell.start && (col < cell.end-1 || idx == last):
+			value.WriteRune(r)
+		}
+
+		col += runeWidth(r)
+	}
+
+	values[idx] = value.String()
+	return values, markers
 }
 
 // Parses MySQL output format:
@@ -55,79 +353,218 @@ func ReadPSQLTable(reader io.Reader, count int64) (*TabularData, error) {
 // +------+------+------+
 // 2 rows in set
 func ReadMySQLTable(reader io.Reader, count int64) (*TabularData, error) {
-	scanner := bufio.NewScanner(reader)
+	data, err := StreamMySQLTable(reader, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.collect()
+}
 
-	// Skip leading horizontal line
-	scanner.Scan()
+// Like ReadMySQLTable, but loads rows into data.Store in the background.
+// As with StreamPSQLTable, any tables after the first are read into
+// data.Results, along with other text such as "Query OK, 1 row affected".
+func StreamMySQLTable(reader io.Reader, count int64) (*TabularData, error) {
+	lines := newLineScanner(bufio.NewScanner(reader))
+	results := newResultSets()
 
-	scanner.Scan()
-	columnString := scanner.Text()
-	columns := parseColumns(columnString[1 : len(columnString)-2])
+	return streamSQLResults("MySQL", results, func() (*sqlResult, error) {
+		return nextMySQLResult(lines, results, count)
+	})
+}
+
+// Read on to the next table, adding any other text on the way to results.
+// Returns nil once the input runs out.
+func nextMySQLResult(lines *lineScanner, results *ResultSets, count int64) (*sqlResult, error) {
+	for lines.scan() {
+		line := strings.TrimRight(lines.text, " \r")
+
+		switch {
+		case line == "":
+		case mysqlRecordRegex.MatchString(line):
+			// Shown by \G instead of ;
+			return streamMySQLVertical(lines, count)
+		case strings.HasPrefix(line, "Empty set"):
+			return emptySQLResult(), nil
+		case mysqlFooterRegex.MatchString(line):
+			// Row count of the table before
+		case isTableRule(line):
+			if result := mysqlResult(lines, results, line, count); result != nil {
+				return result, nil
+			}
+		default:
+			results.addMessages(lines.text)
+		}
+	}
+
+	return nil, lines.scanner.Err()
+}
+
+// A table starting with rule, made up of the header and another rule on
+// the lines after it. If they aren't, they're added to results instead.
+func mysqlResult(lines *lineScanner, results *ResultSets, rule string, count int64) *sqlResult {
+	cells, ok := parseTableRule(rule)
+	if !ok || !lines.scan() {
+		results.addMessages(rule)
+		return nil
+	}
 
-	// Skip trailing horizontal line
-	scanner.Scan()
+	header := trimRightBorder(lines.text)
 
-	rows := [][]string{}
+	if !lines.scan() || !isTableRule(lines.text) {
+		results.addMessages(rule, header, lines.text)
+		return nil
+	}
 
-	var i int64
-	for i = 0; i < count && scanner.Scan(); i++ {
-		row := scanner.Text()
+	next := func() ([]string, error) {
+		if !lines.scan() {
+			return nil, scannerDone(lines.scanner)
+		}
 
-		// last line
-		if row[0] == '+' {
-			break
+		// Bottom border, or whatever follows the table
+		row := trimRightBorder(lines.text)
+		if isTableRule(row) || !strings.HasPrefix(row, "|") {
+			return nil, io.EOF
 		}
 
-		rows = append(rows, parseRow(columns, row[1:len(row)-2]))
+		return splitTableRow(row, cells), nil
 	}
 
+	return newSQLResult(&TabularData{Columns: boundedColumns(header, cells)}, next, count)
+}
+
+// Error to report once a scanner stops returning lines.
+func scannerDone(scanner *bufio.Scanner) error {
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return err
+	}
+
+	return io.EOF
+}
+
+// Wraps a scanner to keep track of line numbers.
+type lineScanner struct {
+	scanner *bufio.Scanner
+	text    string
+	line    int
+}
+
+func newLineScanner(scanner *bufio.Scanner) *lineScanner {
+	return &lineScanner{scanner: scanner}
+}
+
+func (s *lineScanner) scan() bool {
+	if !s.scanner.Scan() {
+		s.text = ""
+		return false
 	}
 
-	return &TabularData{
-		Columns: columns,
-		Rows:    rows,
-	}, nil
+	s.text = s.scanner.Text()
+	s.line++
+
+	return true
 }
 
-func parseColumns(columnString string) []Column {
-	split := strings.Split(columnString, " | ")
+// Where a cell lies within each line, in display columns. Its padding is
+// included but not the borders either side.
+type cellBounds struct {
+	start, end int
+}
+
+// Characters of a rule which mark a border between cells
+const tableRuleJunctions = "+┼├┤┌┐┬"
+
+// Find the cells of a table from the rule under its header, such as
+// "------+------", "+------+------+" or "──────┼──────". Every "+" or box
+// drawing junction marks a border between cells. psql's border 0 leaves out
+// the borders, separating cells with a single space instead.
+func parseTableRule(rule string) ([]cellBounds, bool) {
+	rule = strings.TrimRight(rule, " \r")
+
+	var cells []cellBounds
+	start, col := 0, 0
+	unpadded := false
 
-	columns := make([]Column, len(split))
+	for _, r := range rule {
+		switch {
+		case r == '-' || r == '─':
+		case r == ' ' || strings.ContainsRune(tableRuleJunctions, r):
+			if col > start {
+				cells = append(cells, cellBounds{start, col})
+			}
 
-	for i, col := range split {
-		columns[i] = Column{
-			Name:  strings.TrimSpace(col),
-			Width: len(col),
+			unpadded = unpadded || r == ' '
+			start = col + 1
+		default:
+			return nil, false
 		}
+
+		col++
 	}
 
-	// Make sure we skip the leading space in the first column
-	columns[0].Width--
+	if col > start {
+		cells = append(cells, cellBounds{start, col})
+	}
 
-	return columns
+	if unpadded {
+		cells = unpaddedCells(cells)
+	}
+
+	return cells, len(cells) > 0
+}
+
+// Widen the cells of a table without padding, so they can be treated like
+// those of a padded one. The space after each cell holds its marker, as the
+// right hand padding would.
+func unpaddedCells(cells []cellBounds) []cellBounds {
+	widened := make([]cellBounds, len(cells))
+	for i, cell := range cells {
+		widened[i] = cellBounds{cell.start - 1, cell.end + 1}
+	}
+
+	return widened
 }
 
-// TODO: doesn't handle multi-line rows
-func parseRow(columns []Column, str string) []string {
-	row := make([]string, len(columns))
+// Drop the closing border of a MySQL row, so it isn't part of the last cell
+func trimRightBorder(line string) string {
+	return strings.TrimSuffix(strings.TrimRight(line, " \r"), "|")
+}
+
+// Trimmed cells of a row. Lines are sliced up by display width, so wide
+// characters such as CJK take up two columns as they do in the terminal.
+// The last cell runs on to the end of the line.
+func splitTableRow(line string, cells []cellBounds) []string {
+	row := make([]string, len(cells))
 
-	// Skip leading space
-	offset := 1
+	var cell strings.Builder
+	idx, col := 0, 0
+	last := len(cells) - 1
 
-	for i, col := range columns {
-		// Make sure we don't over shoot the string length
-		if offset+col.Width >= len(str) {
-			row[i] = str[offset:len(str)]
-		} else {
-			row[i] = str[offset : offset+col.Width]
+	for _, r := range line {
+		for idx < last && col >= cells[idx].end {
+			row[idx] = strings.TrimSpace(cell.String())
+			cell.Reset()
+			idx++
 		}
 
-		row[i] = strings.TrimSpace(row[i])
+		if col >= cells[idx].start && (idx == last || col < cells[idx].end) {
+			cell.WriteRune(r)
+		}
 
-		offset += col.Width + 3
+		col += runeWidth(r)
 	}
 
+	row[idx] = strings.TrimSpace(cell.String())
 	return row
 }
+
+// Columns named from the header, which is sliced up the same way as rows.
+func boundedColumns(header string, cells []cellBounds) []Column {
+	columns := make([]Column, len(cells))
+
+	for i, name := range splitTableRow(header, cells) {
+		columns[i] = Column{Name: name, Width: displayWidth(name)}
+	}
+
+	return columns
+}
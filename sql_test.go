@@ -0,0 +1,286 @@
+package vxsv
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A table as it should be read from a SQL client's output
+type sqlTable struct {
+	columns []string
+	rows    [][]string
+}
+
+// Read every result set in a SQL client's output, once all have loaded.
+func readSQLResults(t *testing.T, read func(io.Reader) (*TabularData, error), input string) ([]sqlTable, *ResultSets) {
+	t.Helper()
+
+	data, err := read(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := data.Results.wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tables []sqlTable
+	for _, table := range data.Results.Tables() {
+		if table, err = table.collect(); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, col := range table.Columns {
+			names = append(names, col.Name)
+		}
+
+		tables = append(tables, sqlTable{names, table.Rows})
+	}
+
+	return tables, data.Results
+}
+
+func readPSQL(reader io.Reader) (*TabularData, error) {
+	return StreamPSQLTable(reader, 100)
+}
+
+func readMySQL(reader io.Reader) (*TabularData, error) {
+	return StreamMySQLTable(reader, 100)
+}
+
+func checkSQLTables(t *testing.T, name string, got, want []sqlTable) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("%s: read %d tables, want %d: %q", name, len(got), len(want), got)
+		return
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(got[i].columns, want[i].columns) {
+			t.Errorf("%s: table %d columns = %q, want %q", name, i, got[i].columns, want[i].columns)
+		}
+
+		if !reflect.DeepEqual(got[i].rows, want[i].rows) && (len(got[i].rows) > 0 || len(want[i].rows) > 0) {
+			t.Errorf("%s: table %d rows = %q, want %q", name, i, got[i].rows, want[i].rows)
+		}
+	}
+}
+
+func TestReadPSQLTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []sqlTable
+	}{
+		{
+			name: "border 1",
+			input: ` id | name   | a|b 
+----+--------+-----
+  1 | 日本語 | x|y
+  2 | ok     | 
+(2 rows)
+`,
+			want: []sqlTable{{
+				[]string{"id", "name", "a|b"},
+				[][]string{{"1", "日本語", "x|y"}, {"2", "ok", ""}},
+			}},
+		},
+		{
+			name: "zero rows",
+			input: ` id | name 
+----+------
+(0 rows)
+`,
+			want: []sqlTable{{[]string{"id", "name"}, nil}},
+		},
+		{
+			name: "single column",
+			input: `?column?
+----------
+        1
+(1 row)
+`,
+			want: []sqlTable{{[]string{"?column?"}, [][]string{{"1"}}}},
+		},
+	}
+
+	for _, test := range tests {
+		tables, results := readSQLResults(t, readPSQL, test.input)
+		checkSQLTables(t, test.name, tables, test.want)
+
+		// The footer is part of the table
+		if messages := results.Messages(); len(messages) > 0 {
+			t.Errorf("%s: messages = %q, want none", test.name, messages)
+		}
+	}
+}
+
+func TestReadMySQLTable(t *testing.T) {
+	input := `+----+--------+
+| id | name   |
++----+--------+
+|  1 | 日本語 |
+|  2 | a|b    |
+|  3 | NULL   |
++----+--------+
+3 rows in set (0.00 sec)
+`
+
+	tables, _ := readSQLResults(t, readMySQL, input)
+	checkSQLTables(t, "mysql", tables, []sqlTable{{
+		[]string{"id", "name"},
+		[][]string{{"1", "日本語"}, {"2", "a|b"}, {"3", "NULL"}},
+	}})
+}
+
+func TestReadPSQLMultilineValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []sqlTable
+	}{
+		{
+			name: "newlines",
+			input: ` id | multi+| n 
+    | line  | 
+----+-------+---
+  1 | a    +| 1
+    |   b  +| 
+    | c     | 
+  2 | x     | 2
+(2 rows)
+`,
+			want: []sqlTable{{
+				[]string{"id", "multi line", "n"},
+				[][]string{{"1", "a\n  b\nc", "1"}, {"2", "x", "2"}},
+			}},
+		},
+		{
+			name: "wrapped",
+			input: ` id |      txt       
+----+----------------
+  1 | abcdefghijklmn.
+    |.opqrstuvwxyz
+  2 | one           +
+    | two
+(2 rows)
+`,
+			want: []sqlTable{{
+				[]string{"id", "txt"},
+				[][]string{{"1", "abcdefghijklmnopqrstuvwxyz"}, {"2", "one\ntwo"}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		tables, _ := readSQLResults(t, readPSQL, test.input)
+		checkSQLTables(t, test.name, tables, test.want)
+	}
+}
+
+func TestReadPSQLBorderStyles(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []sqlTable
+	}{
+		{
+			name: "border 0",
+			input: `id name   note
+-- ------ -----
+ 1 foo    a    +
+          b
+ 2 日本語 x
+(2 rows)
+`,
+			want: []sqlTable{{
+				[]string{"id", "name", "note"},
+				[][]string{{"1", "foo", "a\nb"}, {"2", "日本語", "x"}},
+			}},
+		},
+		{
+			name: "border 2",
+			input: `+----+------+
+| id | name |
++----+------+
+|  1 | a|b  |
+|  2 | c   +|
+|    | d    |
++----+------+
+(2 rows)
+`,
+			want: []sqlTable{{
+				[]string{"id", "name"},
+				[][]string{{"1", "a|b"}, {"2", "c\nd"}},
+			}},
+		},
+		{
+			name: "unicode border 1",
+			input: ` id │ name  │ note 
+────┼───────┼──────
+  1 │ foo   │ a   ↵
+    │       │ b
+  2 │ wrapp…│ x
+    │…ed    ┊ 
+(2 rows)
+`,
+			want: []sqlTable{{
+				[]string{"id", "name", "note"},
+				[][]string{{"1", "foo", "a\nb"}, {"2", "wrapped", "x"}},
+			}},
+		},
+		{
+			name: "unicode border 2",
+			input: `┌────┬────────┐
+│ id │ name   │
+├────┼────────┤
+│  1 │ foo   ↵│
+│    │ bar    │
+│  2 │ wrappe…│
+│    │…d      │
+└────┴────────┘
+(2 rows)
+`,
+			want: []sqlTable{{
+				[]string{"id", "name"},
+				[][]string{{"1", "foo\nbar"}, {"2", "wrapped"}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		tables, results := readSQLResults(t, readPSQL, test.input)
+		checkSQLTables(t, test.name, tables, test.want)
+
+		if messages := results.Messages(); len(messages) > 0 {
+			t.Errorf("%s: messages = %q, want none", test.name, messages)
+		}
+	}
+}
+
+func TestReadPSQLNull(t *testing.T) {
+	input := ` id │ name   
+────┼────────
+  1 │ foo
+  2 │ (null)
+(2 rows)
+`
+
+	read := func(reader io.Reader) (*TabularData, error) {
+		return StreamPSQLTableWithOptions(reader, PSQLOptions{Null: "(null)"}, 100)
+	}
+
+	tables, results := readSQLResults(t, read, input)
+	checkSQLTables(t, "null", tables, []sqlTable{{
+		[]string{"id", "name"},
+		[][]string{{"1", "foo"}, {"2", "(null)"}},
+	}})
+
+	if null := results.Tables()[0].Null; null != "(null)" {
+		t.Errorf("Null = %q, want %q", null, "(null)")
+	}
+}
@@ -0,0 +1,176 @@
+// Reading SQLite databases through database/sql.
+
+package vxsv
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Shown for NULL values from a database
+const SQLNull = "NULL"
+
+// OpenSQLite opens a SQLite database file read only.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := (&url.URL{Scheme: "file", Opaque: url.PathEscape(path), RawQuery: "mode=ro"}).String()
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing is actually read until the first query
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// ReadSQLiteTables finds the tables and views in a database, each of which
+// becomes one of the returned table's Tables. Only the first is read
+// straight away, the others are left until they're shown.
+func ReadSQLiteTables(db *sql.DB, count int64) (*TabularData, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []*TabularData
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		query := fmt.Sprintf(`SELECT * FROM "%s"`, strings.ReplaceAll(name, `"`, `""`))
+
+		tables = append(tables, &TabularData{
+			Table: name,
+			Query: query,
+			Open: func() (*TabularData, error) {
+				return StreamSQLQuery(db, query, count)
+			},
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	} else if len(tables) == 0 {
+		return nil, errors.New("Database doesn't have any tables")
+	}
+
+	data := tables[0]
+	if err := data.open(); err != nil {
+		return nil, err
+	}
+
+	if len(tables) > 1 {
+		data.Tables = tables
+	}
+
+	return data, nil
+}
+
+// StreamSQLQuery runs a query, returning once the columns of the result are
+// known and loading its rows into data.Store in the background.
+func StreamSQLQuery(db *sql.DB, query string, count int64) (*TabularData, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+
+	data := &TabularData{Table: "query", Query: query, Null: SQLNull}
+	for _, name := range names {
+		data.Columns = append(data.Columns, Column{Name: name, Width: displayWidth(name)})
+	}
+
+	values := make([]interface{}, len(names))
+	pointers := make([]interface{}, len(names))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	next := func() ([]string, error) {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, io.EOF
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = sqlValue(value)
+		}
+
+		return row, nil
+	}
+
+	store := newLoadingStore()
+
+	go func() {
+		store.load(next, count)
+		rows.Close()
+	}()
+
+	data.Store = store
+	return data, nil
+}
+
+func sqlValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return SQLNull
+	case []byte:
+		if utf8.Valid(value) {
+			return string(value)
+		}
+
+		// Blobs are shown the way SQLite would write them
+		return "x'" + hex.EncodeToString(value) + "'"
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		// The driver reads timestamps without a zone as UTC
+		if value.Location() == time.UTC {
+			return value.Format("2006-01-02 15:04:05.999999999")
+		}
+
+		return value.Format("2006-01-02 15:04:05.999999999Z07:00")
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,272 @@
+// Row storage shared between the loaders and the UI.
+
+package vxsv
+
+import (
+	"io"
+	"sync"
+)
+
+// RowStore holds the rows of a table. Rows may be appended from a
+// background goroutine while the UI is reading them, so implementations
+// must be safe for concurrent use.
+type RowStore interface {
+	Len() int
+	Row(idx int) []string
+
+	// Loading reports whether rows are still being added.
+	Loading() bool
+
+	// Err returns the error that stopped loading early, if any.
+	Err() error
+
+	// Updates receives a value whenever new rows are available, and is
+	// closed once loading has finished.
+	Updates() <-chan struct{}
+
+	// ExtraColumns names columns discovered while loading, which follow
+	// those in TabularData.Columns. Rows loaded before a column was added
+	// may be missing values for it.
+	ExtraColumns() []string
+
+	// Problems lists malformed input which was loaded as best we could, or
+	// skipped over.
+	Problems() []LoadProblem
+}
+
+// Stores which can read a run of rows in one pass more cheaply than calling
+// Row for each of them, for operations over the whole table.
+type rowScanner interface {
+	ScanRows(start, end int, fn func(idx int, row []string))
+}
+
+// LoadProblem describes a malformed line of input.
+type LoadProblem struct {
+	Line   int
+	Reason string
+
+	// What we made of the line, if anything
+	Text string
+}
+
+// Bookkeeping shared by stores which are filled in the background.
+type loadState struct {
+	mu      sync.RWMutex
+	loading bool
+	err     error
+	updates chan struct{}
+
+	extraColumns []string
+	problems     []LoadProblem
+}
+
+func newLoadState(loading bool) loadState {
+	updates := make(chan struct{}, 1)
+	if !loading {
+		close(updates)
+	}
+
+	return loadState{loading: loading, updates: updates}
+}
+
+func (s *loadState) Loading() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.loading
+}
+
+func (s *loadState) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+func (s *loadState) Updates() <-chan struct{} {
+	return s.updates
+}
+
+// Both of these are only ever appended to, so it's safe to hand out the
+// current slices without copying.
+func (s *loadState) ExtraColumns() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.extraColumns[:len(s.extraColumns):len(s.extraColumns)]
+}
+
+func (s *loadState) Problems() []LoadProblem {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.problems[:len(s.problems):len(s.problems)]
+}
+
+func (s *loadState) addColumn(name string) {
+	s.mu.Lock()
+	s.extraColumns = append(s.extraColumns, name)
+	s.mu.Unlock()
+}
+
+func (s *loadState) addProblem(problem LoadProblem) {
+	s.mu.Lock()
+	s.problems = append(s.problems, problem)
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Wake up anyone listening for updates without blocking the loader. Pending
+// notifications are coalesced.
+func (s *loadState) notify() {
+	select {
+	case s.updates <- struct{}{}:
+	default:
+	}
+}
+
+func (s *loadState) finish(err error) {
+	s.mu.Lock()
+	s.loading = false
+	s.err = err
+	s.mu.Unlock()
+
+	close(s.updates)
+}
+
+// Wait blocks until loading has finished.
+func (s *loadState) wait() error {
+	for range s.updates {
+	}
+
+	return s.Err()
+}
+
+// MemoryStore keeps every row in memory.
+type MemoryStore struct {
+	loadState
+	rows [][]string
+}
+
+// NewMemoryStore wraps rows which have already been fully loaded.
+func NewMemoryStore(rows [][]string) *MemoryStore {
+	return &MemoryStore{
+		loadState: newLoadState(false),
+		rows:      rows,
+	}
+}
+
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.rows)
+}
+
+func (s *MemoryStore) Row(idx int) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.rows[idx]
+}
+
+func (s *MemoryStore) append(row []string) {
+	s.mu.Lock()
+	s.rows = append(s.rows, row)
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Yields the next parsed row, or io.EOF once the input is exhausted.
+type rowSource func() ([]string, error)
+
+// Read up to count rows from next into a new store in the background,
+// returning immediately.
+func streamRows(next rowSource, count int64) *MemoryStore {
+	store := newLoadingStore()
+	go store.load(next, count)
+
+	return store
+}
+
+// Create an empty store for a loader to fill
+func newLoadingStore() *MemoryStore {
+	return &MemoryStore{
+		loadState: newLoadState(true),
+		rows:      make([][]string, 0, 100),
+	}
+}
+
+func (s *MemoryStore) load(next rowSource, count int64) {
+	var err error
+
+	for i := int64(0); i < count; i++ {
+		var row []string
+		if row, err = next(); err != nil {
+			break
+		}
+
+		s.append(row)
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+
+	s.finish(err)
+}
+
+// The store backing data, wrapping Rows if it was read synchronously.
+func (data *TabularData) rowStore() RowStore {
+	if data.Store != nil {
+		return data.Store
+	}
+
+	store := NewMemoryStore(data.Rows)
+	store.problems = data.Problems
+	return store
+}
+
+// Block until a streamed table has finished loading, then fill in Rows and
+// the column widths the way the synchronous readers always have.
+func (data *TabularData) collect() (*TabularData, error) {
+	store, ok := data.Store.(*MemoryStore)
+	if !ok {
+		return data, nil
+	}
+
+	if err := store.wait(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range store.extraColumns {
+		data.Columns = append(data.Columns, Column{Name: name, Width: displayWidth(name)})
+	}
+
+	data.Rows = store.rows
+	data.Problems = store.problems
+	data.Store = nil
+
+	for i, row := range data.Rows {
+		// Rows loaded before an extra column showed up won't have it
+		for len(row) < len(data.Columns) {
+			row = append(row, data.Null)
+		}
+
+		data.Rows[i] = row
+		fitColumns(data.Columns, row)
+	}
+
+	return data, nil
+}
+
+// Widen columns so that every cell of row fits.
+func fitColumns(columns []Column, row []string) {
+	for i, cell := range row {
+		if i < len(columns) && displayWidth(cell) > columns[i].Width {
+			columns[i].Width = displayWidth(cell)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Inputs holding several tables, such as the sheets of a spreadsheet.
+
+package vxsv
+
+import (
+	"fmt"
+)
+
+// How a table was being viewed, kept while another table is shown.
+type tableView struct {
+	columns          []Column
+	rows             RowStore
+	extraColumns     int
+	filter           Filter
+	sort             *sortOrder
+	unique           *uniqueValues
+	offsetX, offsetY int
+}
+
+func newTableView(data *TabularData) (*tableView, error) {
+	if err := data.open(); err != nil {
+		return nil, err
+	}
+
+	return &tableView{
+		columns: data.Columns,
+		rows:    data.rowStore(),
+		filter:  EmptyFilter{},
+	}, nil
+}
+
+// Read a table which was left until it was needed.
+func (data *TabularData) open() error {
+	if data.Open == nil {
+		return nil
+	}
+
+	opened, err := data.Open()
+	if err != nil {
+		return err
+	}
+
+	data.Columns = opened.Columns
+	data.Rows = opened.Rows
+	data.Store = opened.Store
+	data.Null = opened.Null
+	data.Open = nil
+
+	return nil
+}
+
+// Remember which tables there are to switch between, and which of them is
+// being shown. Inputs with a single table don't list it in Tables.
+func (ui *UI) setTables(tables []*TabularData, current *TabularData) {
+	if len(tables) == 0 {
+		tables = []*TabularData{current}
+	}
+
+	ui.tables = tables
+	ui.tableIdx = 0
+	ui.views = make([]*tableView, len(tables))
+
+	for i, table := range tables {
+		if table == current {
+			ui.tableIdx = i
+		}
+	}
+}
+
+// Name of the table being shown and where it is among the others, for the
+// mode line.
+func (ui *UI) tableLabel() string {
+	if len(ui.tables) < 2 {
+		return ""
+	}
+
+	return fmt.Sprintf("[%s %d/%d]", ui.tables[ui.tableIdx].Table, ui.tableIdx+1, len(ui.tables))
+}
+
+// Show another of the input's tables. How the current one was being viewed
+// is remembered for when we come back to it.
+func (ui *UI) showTable(idx int) {
+	if idx == ui.tableIdx {
+		return
+	}
+
+	view := ui.views[idx]
+	if view == nil {
+		var err error
+		if view, err = newTableView(ui.tables[idx]); err != nil {
+			ui.pushErrorPopup(fmt.Sprintf("Failed to read %s", ui.tables[idx].Table), err)
+			return
+		}
+	}
+
+	ui.saveView()
+	ui.loadView(idx, view)
+}
+
+// Show a table which wasn't read from the input, such as the results of a
+// query. It replaces any earlier table of the same name.
+func (ui *UI) addTable(data *TabularData) error {
+	view, err := newTableView(data)
+	if err != nil {
+		return err
+	}
+
+	idx := len(ui.tables)
+	for i, table := range ui.tables {
+		if table.Table == data.Table {
+			idx = i
+		}
+	}
+
+	if idx != ui.tableIdx {
+		ui.saveView()
+	}
+
+	if idx == len(ui.tables) {
+		ui.tables = append(ui.tables, data)
+		ui.views = append(ui.views, nil)
+	} else {
+		ui.tables[idx] = data
+	}
+
+	ui.loadView(idx, view)
+	return nil
+}
+
+func (ui *UI) saveView() {
+	ui.views[ui.tableIdx] = &tableView{
+		columns:      ui.columns,
+		rows:         ui.rows,
+		extraColumns: ui.extraColumns,
+		filter:       ui.filter,
+		sort:         ui.sort,
+		unique:       ui.unique,
+		offsetX:      ui.offsetX,
+		offsetY:      ui.offsetY,
+	}
+}
+
+func (ui *UI) loadView(idx int, view *tableView) {
+	ui.tableIdx = idx
+	ui.null = ui.tables[idx].Null
+	ui.columns = view.columns
+	ui.rows = view.rows
+	ui.extraColumns = view.extraColumns
+	ui.filter = view.filter
+	ui.sort = view.sort
+	ui.unique = view.unique
+	ui.offsetX, ui.offsetY = view.offsetX, view.offsetY
+	ui.rowIdx = 0
+	ui.tailing = false
+
+	// Rows are matched against the filter again from scratch
+	ui.rowCount = 0
+	ui.resetMatches()
+	ui.loading = true
+
+	ui.switchToDefault()
+	ui.syncRows()
+	ui.watchRows()
+}
+
+// Move on to the next table, wrapping around after the last.
+func (ui *UI) nextTable() {
+	if len(ui.tables) < 2 {
+		ui.pushHandler(NewPopup(ui, "There's only one table in this input."))
+		return
+	}
+
+	ui.showTable((ui.tableIdx + 1) % len(ui.tables))
+}
+
+// PickTable opens a list of the input's tables to choose from.
+func (ui *UI) PickTable() {
+	if len(ui.tables) < 2 {
+		ui.pushHandler(NewPopup(ui, "There's only one table in this input."))
+		return
+	}
+
+	names := make([]string, len(ui.tables))
+	for i, table := range ui.tables {
+		names[i] = table.Table
+	}
+
+	ui.pushHandler(NewPicker(ui, "Tables", names, ui.tableIdx, func(idx int) {
+		ui.showTable(idx)
+	}))
+}
+
+// QueryRunner runs a query typed in by the user, such as SQL against a
+// database, and returns its results.
+type QueryRunner func(query string) (*TabularData, error)
+
+// EnableQuery lets queries be edited and run with run, showing their results
+// as another table.
+func (ui *UI) EnableQuery(run QueryRunner) {
+	ui.query = run
+}
+
+// Start editing a query, from the one the current table was read with.
+func (ui *UI) editQuery() {
+	if ui.query == nil {
+		ui.pushHandler(NewPopup(ui, "Queries can only be run against databases."))
+		return
+	}
+
+	ui.pushHandler(&HandlerQuery{HandlerDefault{ui}, ui.tables[ui.tableIdx].Query})
+}
+
+func (ui *UI) runQuery(query string) {
+	data, err := ui.query(query)
+	if err == nil {
+		err = ui.addTable(data)
+	}
+
+	if err != nil {
+		ui.pushErrorPopup("Failed to run query: "+query, err)
+	}
+}
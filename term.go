@@ -5,24 +5,111 @@ package vxsv
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
+	"golang.org/x/text/unicode/norm"
 )
 
+// Measures text in terminal columns, as termbox draws it: East Asian wide
+// characters take up two and combining marks none. Characters of ambiguous
+// width, such as box drawing, take up one whatever the locale, which is
+// also how psql and mysql line their tables up.
+var displayWidths = &runewidth.Condition{EastAsianWidth: false, StrictEmojiNeutral: true}
+
+func runeWidth(r rune) int {
+	// Drawn as a space
+	if r < ' ' {
+		return 1
+	}
+
+	return displayWidths.RuneWidth(r)
+}
+
+// Width of str in terminal columns.
+func displayWidth(str string) int {
+	width := 0
+	for _, r := range str {
+		width += runeWidth(r)
+	}
+
+	return width
+}
+
+// Pad str with spaces on the right to fill width columns.
+func padRight(str string, width int) string {
+	if pad := width - displayWidth(str); pad > 0 {
+		return str + strings.Repeat(" ", pad)
+	}
+
+	return str
+}
+
+// Pad str with spaces on the left to fill width columns.
+func padLeft(str string, width int) string {
+	if pad := width - displayWidth(str); pad > 0 {
+		return strings.Repeat(" ", pad) + str
+	}
+
+	return str
+}
+
+// Cut str down to fit in width columns, ending it with "…" if anything had
+// to go.
+func truncate(str string, width int) string {
+	if displayWidth(str) <= width {
+		return str
+	}
+
+	return sliceWidth(str, 0, width-1) + "…"
+}
+
+// The part of str from column start on which fits in width columns. Wide
+// characters cut in half at either end are left out.
+func sliceWidth(str string, start, width int) string {
+	var sliced strings.Builder
+	col := 0
+
+	for _, r := range str {
+		w := runeWidth(r)
+		if col >= start && col+w <= start+width {
+			sliced.WriteRune(r)
+		} else if col >= start+width {
+			break
+		}
+
+		col += w
+	}
+
+	return sliced.String()
+}
+
+// Draw a character, returning the column the next one goes in. termbox
+// can't draw combining marks over the character before them, so text is
+// composed with norm.NFC first, and any marks left over are dropped.
+func drawRune(x, y int, ch rune, fg, bg termbox.Attribute) int {
+	w := runeWidth(ch)
+	if w > 0 {
+		termbox.SetCell(x, y, ch, fg, bg)
+	}
+
+	return x + w
+}
+
 func writeStringBounded(x, y, bound int, fg, bg termbox.Attribute, msg string) int {
-	for _, c := range msg {
+	for _, c := range norm.NFC.String(msg) {
 		if x >= bound {
-			termbox.SetCell(x, y, c, fg, bg)
+			drawRune(x, y, c, fg, bg)
 		}
-		x++
+		x += runeWidth(c)
 	}
 	return x
 }
 
 func writeString(x, y int, fg, bg termbox.Attribute, msg string) int {
-	for _, c := range msg {
-		termbox.SetCell(x, y, c, fg, bg)
-		x++
+	for _, c := range norm.NFC.String(msg) {
+		x = drawRune(x, y, c, fg, bg)
 	}
 	return x
 }
@@ -31,9 +118,8 @@ func writeString(x, y int, fg, bg termbox.Attribute, msg string) int {
 func writeLine(x, y int, fg, bg termbox.Attribute, line string) {
 	width, _ := termbox.Size()
 
-	for _, c := range line {
-		termbox.SetCell(x, y, c, fg, bg)
-		x++
+	for _, c := range norm.NFC.String(line) {
+		x = drawRune(x, y, c, fg, bg)
 	}
 	for i := x; i < width; i++ {
 		termbox.SetCell(x+i, y, ' ', fg, bg)
@@ -48,21 +134,13 @@ func (ui *UI) writeModeLine(mode string, left []string) {
 		termbox.SetCell(i, height-1, ' ', termbox.ColorDefault, termbox.ColorDefault)
 	}
 
-	var x int
-	for _, ch := range mode {
-		termbox.SetCell(x, height-1, ch, termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault)
-		x++
-	}
+	x := writeString(0, height-1, termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault, mode)
 
 	termbox.SetCell(x, height-1, ' ', termbox.ColorDefault, termbox.ColorDefault)
 	x++
 
 	for _, str := range left {
-		for _, ch := range str {
-			termbox.SetCell(x, height-1, ch, termbox.ColorDefault, termbox.ColorDefault)
-			x++
-		}
-
+		x = writeString(x, height-1, termbox.ColorDefault, termbox.ColorDefault, str)
 		x++
 	}
 
@@ -70,17 +148,31 @@ func (ui *UI) writeModeLine(mode string, left []string) {
 	last := clamp(ui.offsetY+height, 0, len(ui.filterMatches))
 	total := len(ui.filterMatches)
 	filterString := ""
+	loadingString := ""
+	problemString := ""
 
 	if _, ok := ui.filter.(EmptyFilter); !ok {
 		filterString = fmt.Sprintf("filter:\"%s\" :: ", ui.filter.String())
 	}
 
-	right := fmt.Sprintf("%srows %d-%d of %d", filterString, first, last, total)
-	x = len(right)
-	for _, ch := range right {
-		termbox.SetCell(width-x, height-1, ch, termbox.ColorGreen|termbox.AttrBold, termbox.ColorDefault)
-		x--
+	if ui.unique != nil {
+		filterString += fmt.Sprintf("unique:[%s] :: ", ui.unique.column)
+	}
+
+	if ui.loading && ui.following {
+		loadingString = fmt.Sprintf("following… %d rows :: ", ui.rowCount)
+	} else if ui.loading {
+		loadingString = fmt.Sprintf("loading… %d rows :: ", ui.rowCount)
+	}
+
+	if problems := len(ui.rows.Problems()); problems == 1 {
+		problemString = "1 bad line :: "
+	} else if problems > 1 {
+		problemString = fmt.Sprintf("%d bad lines :: ", problems)
 	}
+
+	right := fmt.Sprintf("%s%s%srows %d-%d of %d", loadingString, problemString, filterString, first, last, total)
+	writeString(width-displayWidth(right), height-1, termbox.ColorGreen|termbox.AttrBold, termbox.ColorDefault, right)
 }
 
 func (ui *UI) writeCell(cell string, x, y, index, pinBound int, fg, bg termbox.Attribute) int {
@@ -89,6 +181,8 @@ func (ui *UI) writeCell(cell string, x, y, index, pinBound int, fg, bg termbox.A
 	if col.Highlight {
 		fg = HiliteFg
 		bg = HiliteBg
+	} else if ui.null != "" && cell == ui.null {
+		fg = NullFg
 	}
 
 	formatted := cell
@@ -96,16 +190,9 @@ func (ui *UI) writeCell(cell string, x, y, index, pinBound int, fg, bg termbox.A
 	switch col.Display {
 	case ColumnDefault:
 		width := clamp(col.Width, 0, MaxCellWidth)
-
-		if len(formatted) > width {
-			formatted = fmt.Sprintf("%-*s…", width-1, formatted[:width-1])
-		} else {
-			formatted = fmt.Sprintf("%-*s", width, formatted)
-		}
+		formatted = padRight(truncate(formatted, width), width)
 	case ColumnExpanded:
-		if len(formatted) < col.Width {
-			formatted = fmt.Sprintf("%-*s", col.Width, formatted)
-		}
+		formatted = padRight(formatted, col.Width)
 	case ColumnCollapsed:
 		formatted = "…"
 	case ColumnAligned:
@@ -114,7 +201,7 @@ func (ui *UI) writeCell(cell string, x, y, index, pinBound int, fg, bg termbox.A
 		if val, err := strconv.ParseFloat(cell, 64); err == nil {
 			formatted = fmt.Sprintf("%*.4f", width, val)
 		} else {
-			formatted = fmt.Sprintf("%*s", width, formatted)
+			formatted = padLeft(formatted, width)
 		}
 	}
 
@@ -2,6 +2,10 @@ package vxsv
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nsf/termbox-go"
 )
@@ -13,6 +17,12 @@ const RowIndicator = '»'
 const HiliteFg = termbox.ColorBlack | termbox.AttrBold
 const HiliteBg = termbox.ColorWhite
 
+// Color of null values, so they stand out from empty strings
+const NullFg = termbox.ColorBlue
+
+// How often to repaint while rows are still being loaded
+const LoadRefreshInterval = 100 * time.Millisecond
+
 const HelpText = `Key Bindings:
 
 vxsv is a modal viewer, meaning that actions are only valid in certain
@@ -29,7 +39,14 @@ DEFAULT MODE
   [SPACE]         scroll down one screen
   C               enter ** COLUMN SELECT MODE **
   R               enter ** ROW SELECT MODE **
-  G               scroll to bottom
+  G               scroll to bottom, and stay there as new rows arrive
+  F5              reload the file, keeping the current view
+  i               show information about the input file
+  E               list malformed lines skipped or patched up while loading
+  [TAB]           switch to the next sheet or table, if there are several
+  T               pick a sheet or table from a list
+  M               show the messages printed around psql or mysql tables
+  Q               edit and run a query, for databases
   g               scroll to top
   Z               toggle zebra stripes
   X               toggle expanding all columns
@@ -50,7 +67,7 @@ COLUMN SELECT MODE
   .               toggle pinning this column
   !               pipe column into shell, see ** SHELL COMMAND MODE **
   |               like '!', but replace column with output
-  u               filter rows to unique values for this column
+  u               toggle filtering rows to unique values for this column
   s               show summary statistics for this column
   [ESC], Ctrl g   return to ** DEFAULT MODE **
 
@@ -74,6 +91,16 @@ FILTER MODE
   Ctrl w, Ctrl u  clear entered filter expression
   [ENTER]         apply filter and return to previous mode
 
+QUERY MODE
+==========
+
+  Edit a SQL query against the database, starting from the one the current
+  table was read with. Its results are shown as a table named "query".
+
+  [ESC], Ctrl g   return to previous mode without running the query
+  Ctrl w, Ctrl u  clear entered query
+  [ENTER]         run query and show its results
+
 ROW SELECT MODE
 ===============
 
@@ -112,8 +139,53 @@ type UI struct {
 	filterMatches    []int
 	zebraStripe      bool
 	allExpanded      bool
+	name             string
+	source           SourceInfo
+	null             string
 	columns          []Column
-	rows             [][]string
+	rows             RowStore
+	rowCount         int  // Number of rows from the store seen so far
+	extraColumns     int  // Number of the store's extra columns added so far
+	loading          bool // Whether the store was still loading at last sync
+	following        bool // Whether the input is being followed as it grows
+	tailing          bool // Keep scrolled to the bottom as rows arrive
+	sort             *sortOrder
+	unique           *uniqueValues
+
+	tables   []*TabularData // Every table in the input, if there are several
+	tableIdx int
+	views    []*tableView // Saved state of the tables not being shown
+	query    QueryRunner
+
+	results     *ResultSets   // Tables still being read from the input, if any
+	resultCount int           // Number of them added to tables so far
+	stopResults chan struct{} // Closed once results is replaced
+
+	loader     Loader
+	watchPath  string
+	reloads    chan struct{}
+	closeInput func() // See TabularData.Close
+
+	// A reloaded input which hasn't yet read as far as the result set being
+	// shown, and is swapped in once it has
+	pendingReload *TabularData
+
+	stopWatching chan struct{} // Closed once the store being watched is replaced
+}
+
+// Sort applied to the filtered rows. The column is kept by name so that it
+// survives reloading.
+type sortOrder struct {
+	column     string
+	descending bool
+}
+
+// Rows are narrowed down to the first with each value of a column. Like
+// sortOrder, the column is kept by name so that it survives reloading.
+type uniqueValues struct {
+	column string
+	colIdx int
+	seen   map[string]struct{}
 }
 
 type Column struct {
@@ -131,8 +203,59 @@ type Column struct {
 }
 
 type TabularData struct {
+	// Shown in the mode line, usually the file name
+	Name string
+
 	Columns []Column
 	Rows    [][]string
+
+	// Value shown for cells missing from a row, if not blank
+	Null string
+
+	// Name of this table within the input, such as a sheet name
+	Table string
+
+	// Every table in the input when there is more than one, such as the
+	// sheets of a spreadsheet, including this one. The UI can switch
+	// between them.
+	Tables []*TabularData
+
+	// Reads this table when it's first shown, for inputs such as databases
+	// where reading every table up front would be wasteful. Only used for
+	// the other entries in Tables.
+	Open func() (*TabularData, error)
+
+	// Query this table was read with, for inputs such as databases. It's
+	// where editing a query starts from, see EnableQuery.
+	Query string
+
+	// Every result set in the output of a SQL client, such as psql running
+	// a script. Unlike Tables, more are added while the input is read.
+	Results *ResultSets
+
+	// Set instead of Rows when rows are loaded in the background
+	Store RowStore
+
+	// Whether Store keeps growing with the input, see NewFollowReader
+	Follow bool
+
+	// Stops reading the input, such as by closing the file it came from,
+	// once the table has been replaced by reloading. May be nil.
+	Close func()
+
+	Source SourceInfo
+
+	// Malformed input encountered by the synchronous readers. Streamed
+	// tables report these through Store instead.
+	Problems []LoadProblem
+}
+
+// Where a table came from and how it was decoded, for the file info popup.
+type SourceInfo struct {
+	Path        string
+	Format      string
+	Compression string
+	Encoding    string
 }
 
 type ColumnDisplay int
@@ -180,7 +303,7 @@ func clamp(val, lo, hi int) int {
 	return val
 }
 func NewUI(data *TabularData) *UI {
-	filterMatches := make([]int, len(data.Rows))
+	store := data.rowStore()
 
 	for i, col := range data.Columns {
 		col.Display = ColumnDefault
@@ -194,22 +317,28 @@ func NewUI(data *TabularData) *UI {
 		}
 	}
 
-	for i := range data.Rows {
-		filterMatches[i] = i
-	}
-
 	ui := &UI{
 		offsetX:       0,
 		offsetY:       0,
-		rows:          data.Rows,
+		name:          data.Name,
+		source:        data.Source,
+		null:          data.Null,
+		rows:          store,
 		columns:       data.Columns,
 		zebraStripe:   true,
 		allExpanded:   false,
 		filter:        EmptyFilter{},
-		filterMatches: filterMatches,
+		filterMatches: make([]int, 0, store.Len()),
+		loading:       true,
+		following:     data.Follow,
+		reloads:       make(chan struct{}, 1),
+		closeInput:    data.Close,
 	}
 
+	ui.setTables(data.Tables, data)
+	ui.setResults(data.Results, 0)
 	ui.switchToDefault()
+	ui.syncRows()
 
 	return ui
 }
@@ -228,6 +357,14 @@ func (ui *UI) Loop() {
 
 	ui.repaint()
 
+	ui.watchRows()
+
+	ui.watchResults(ui.results)
+
+	if ui.loader != nil && ui.watchPath != "" {
+		go ui.watchFile(ui.watchPath)
+	}
+
 eventloop:
 	for {
 		switch ev := termbox.PollEvent(); ev.Type {
@@ -237,23 +374,292 @@ eventloop:
 			}
 
 			ui.activeHandler().HandleKey(ev)
+		case termbox.EventInterrupt:
+			select {
+			case <-ui.reloads:
+				ui.reload()
+			default:
+				if ui.pendingReload != nil {
+					ui.replaceData(ui.pendingReload)
+				}
+			}
+
+			ui.syncResults()
+			ui.syncRows()
 		}
 
 		ui.repaint()
+
+		// Stores which decode rows lazily only find out how wide they are
+		// once they've been painted
+		if ui.widenColumns() {
+			ui.repaint()
+		}
+	}
+}
+
+// Wake up the event loop whenever the store has new rows for us, until stop
+// is closed. Updates are rate limited so a fast loader doesn't starve the
+// keyboard.
+func (ui *UI) watchStore(store RowStore, stop <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-store.Updates():
+			termbox.Interrupt()
+			if !ok {
+				return
+			}
+
+			time.Sleep(LoadRefreshInterval)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Watch the store being shown, no longer waking up for the one shown before.
+func (ui *UI) watchRows() {
+	if ui.stopWatching != nil {
+		close(ui.stopWatching)
+	}
+
+	ui.stopWatching = make(chan struct{})
+	go ui.watchStore(ui.rows, ui.stopWatching)
+}
+
+// Pick up any rows added to the store since the last sync, widening columns
+// and running the active filter over only the new rows.
+func (ui *UI) syncRows() {
+	// Check this first so we can't miss rows added after taking the length
+	loading := ui.rows.Loading()
+	total := ui.rows.Len()
+
+	// Columns are added before any row which needs them, so checking after
+	// taking the length means none can be missing
+	for _, name := range ui.rows.ExtraColumns()[ui.extraColumns:] {
+		ui.columns = append(ui.columns, Column{Name: name, Width: displayWidth(name)})
+		ui.extraColumns++
+	}
+
+	// Avoid decoding every row if the store already knows the widths
+	_, knowsWidths := ui.rows.(columnWidther)
+	_, unfiltered := ui.filter.(EmptyFilter)
+	unfiltered = unfiltered && ui.unique == nil
+
+	ui.widenColumns()
+
+	if knowsWidths && unfiltered {
+		for i := ui.rowCount; i < total; i++ {
+			ui.filterMatches = append(ui.filterMatches, i)
+		}
+	} else {
+		ui.scanRows(ui.rowCount, total, func(i int, row []string) {
+			if !knowsWidths {
+				fitColumns(ui.columns, row)
+			}
+
+			if ui.matches(row) {
+				ui.filterMatches = append(ui.filterMatches, i)
+			}
+		})
+	}
+
+	ui.rowCount = total
+
+	if ui.tailing {
+		ui.offsetY = ui.maxOffsetY()
 	}
+
+	if ui.loading && !loading {
+		// New rows were appended unsorted, so catch up now
+		ui.sortRows()
+
+		if err := ui.rows.Err(); err != nil {
+			ui.pushErrorPopup(fmt.Sprintf("Stopped loading after %d rows", total), err)
+		}
+	}
+
+	ui.loading = loading
+}
+
+// Take on the column widths from stores which keep track of them, returning
+// whether any column got wider.
+func (ui *UI) widenColumns() bool {
+	widther, ok := ui.rows.(columnWidther)
+	if !ok {
+		return false
+	}
+
+	widened := false
+	for i, width := range widther.ColumnWidths() {
+		if i < len(ui.columns) && !ui.columns[i].Modified && width > ui.columns[i].Width {
+			ui.columns[i].Width = width
+			widened = true
+		}
+	}
+
+	return widened
 }
 
 // Return indices of rows to display
 func (ui *UI) filterRows() {
-	rows := make([]int, 0, 100)
+	ui.resetMatches()
 
-	for i := 0; i < len(ui.rows); i++ {
-		if ui.filter.Matches(ui.getRow(i)) {
-			rows = append(rows, i)
+	ui.scanRows(0, ui.rowCount, func(i int, row []string) {
+		if ui.matches(row) {
+			ui.filterMatches = append(ui.filterMatches, i)
 		}
+	})
+
+	ui.sortRows()
+}
+
+// Start matching rows against the filter from scratch.
+func (ui *UI) resetMatches() {
+	ui.filterMatches = make([]int, 0, ui.rows.Len())
+
+	if ui.unique == nil {
+		return
+	} else if ui.unique.colIdx = ui.columnIndex(ui.unique.column); ui.unique.colIdx == -1 {
+		ui.unique = nil
+		return
 	}
 
-	ui.filterMatches = rows
+	ui.unique.seen = make(map[string]struct{})
+}
+
+// Whether a row passes the filter, and is the first with its value in the
+// unique column, if any. Rows have to be checked in order.
+func (ui *UI) matches(row []string) bool {
+	if !ui.filter.Matches(row) {
+		return false
+	} else if ui.unique == nil {
+		return true
+	}
+
+	val := row[ui.unique.colIdx]
+	if _, present := ui.unique.seen[val]; present {
+		return false
+	}
+
+	ui.unique.seen[val] = struct{}{}
+	return true
+}
+
+// Show only the first row with each value of a column, or every row again
+// if that's what's already being shown.
+func (ui *UI) toggleUnique(colIdx int) {
+	name := ui.columns[colIdx].Name
+
+	if ui.unique != nil && ui.unique.column == name {
+		ui.unique = nil
+	} else {
+		ui.unique = &uniqueValues{column: name}
+	}
+
+	ui.filterRows()
+}
+
+// Sort the filtered rows by the given column, and keep them sorted when the
+// filter changes or the table is reloaded.
+func (ui *UI) sortBy(colIdx int, descending bool) {
+	ui.sort = &sortOrder{ui.columns[colIdx].Name, descending}
+	ui.sortRows()
+}
+
+func (ui *UI) sortRows() {
+	if ui.sort == nil {
+		return
+	}
+
+	colIdx := ui.columnIndex(ui.sort.column)
+	if colIdx == -1 {
+		ui.sort = nil
+		return
+	}
+
+	sorter := &rowSorter{ui.filterMatches, ui.sortKeys(colIdx)}
+
+	if ui.sort.descending {
+		sort.Stable(sort.Reverse(sorter))
+	} else {
+		sort.Stable(sorter)
+	}
+}
+
+// Value of a row to sort by, parsed once rather than on every comparison
+type sortKey struct {
+	text    string
+	number  float64
+	numeric bool
+}
+
+// Read the values of a column for each of filterMatches.
+func (ui *UI) sortKeys(colIdx int) []sortKey {
+	keys := make([]sortKey, len(ui.filterMatches))
+
+	ui.scanMatches(func(i int, row []string) {
+		text := row[colIdx]
+		number, err := strconv.ParseFloat(text, 32)
+
+		keys[i] = sortKey{text, number, err == nil}
+	})
+
+	return keys
+}
+
+// Call fn with each of filterMatches and its position there. Rows are read
+// in the order they're stored rather than the order they're shown, so that
+// stores which read them from disk can do so in as few passes as possible.
+func (ui *UI) scanMatches(fn func(i int, row []string)) {
+	byRow := make([]int, len(ui.filterMatches))
+	for i := range byRow {
+		byRow[i] = i
+	}
+
+	sort.Slice(byRow, func(i, j int) bool {
+		return ui.filterMatches[byRow[i]] < ui.filterMatches[byRow[j]]
+	})
+
+	// Read each run of consecutive rows together
+	for start := 0; start < len(byRow); {
+		end := start + 1
+		for end < len(byRow) && ui.filterMatches[byRow[end]] == ui.filterMatches[byRow[end-1]]+1 {
+			end++
+		}
+
+		first := ui.filterMatches[byRow[start]]
+		ui.scanRows(first, first+end-start, func(idx int, row []string) {
+			fn(byRow[start+idx-first], row)
+		})
+
+		start = end
+	}
+}
+
+// Sorts filterMatches by the values of a column
+type rowSorter struct {
+	rows []int
+	keys []sortKey
+}
+
+func (s *rowSorter) Len() int {
+	return len(s.rows)
+}
+
+func (s *rowSorter) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func (s *rowSorter) Less(i, j int) bool {
+	key1, key2 := s.keys[i], s.keys[j]
+
+	if key1.numeric && key2.numeric {
+		return key1.number < key2.number
+	}
+
+	return key1.text < key2.text
 }
 
 func (ui *UI) repaint() {
@@ -285,11 +691,17 @@ func (ui *UI) viewSize() (int, int) {
 	return width - pinnedWidth, height - 2
 }
 
+// Largest vertical offset that still fills the screen
+func (ui *UI) maxOffsetY() int {
+	_, vh := ui.viewSize()
+	return clamp(len(ui.filterMatches)-(vh-2), 0, len(ui.filterMatches)-1)
+}
+
 func (ui *UI) pinnedWidth() (width int) {
 	for _, col := range ui.columns {
 		if col.Pinned {
 			width += col.displayWidth()
-			width += len(CellSeparator)
+			width += displayWidth(CellSeparator)
 		}
 	}
 
@@ -312,7 +724,7 @@ func (ui *UI) columnOffset(colIdx int) (offset int, width int) {
 		if !col.Pinned {
 			width = col.displayWidth()
 			offset += width
-			offset += len(CellSeparator)
+			offset += displayWidth(CellSeparator)
 		}
 	}
 
@@ -320,18 +732,28 @@ func (ui *UI) columnOffset(colIdx int) (offset int, width int) {
 }
 
 func (ui *UI) recomputeColumnWidth(colIdx int) {
-	width := len(ui.columns[colIdx].Name)
+	width := displayWidth(ui.columns[colIdx].Name)
 
-	for _, idx := range ui.filterMatches {
-		row := ui.getRow(idx)
-		if len(row[colIdx]) > width {
-			width = len(row[colIdx])
+	ui.scanMatches(func(_ int, row []string) {
+		if cellWidth := displayWidth(row[colIdx]); cellWidth > width {
+			width = cellWidth
 		}
-	}
+	})
 
 	ui.columns[colIdx].Width = width
 }
 
+// Find a column by name, or -1 if there is no such column
+func (ui *UI) columnIndex(name string) int {
+	for i, col := range ui.columns {
+		if col.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
 // Find the first visually displayed column
 func (ui *UI) findFirstColumn() int {
 	for i, col := range ui.columns {
@@ -396,25 +818,119 @@ func (ui *UI) popHandler() {
 	}
 }
 
+func (ui *UI) pushInfoPopup() {
+	source := ui.source
+	status := "loaded"
+
+	if ui.loading && ui.following {
+		status = "following"
+	} else if ui.loading {
+		status = "loading"
+	}
+
+	if source.Path == "" {
+		source.Path = "<stdin>"
+	}
+
+	if source.Compression == "" {
+		source.Compression = "none"
+	}
+
+	text := fmt.Sprintf(`
+  [ file info ]
+  -------------
+  path:         %s
+  format:       %s
+  compression:  %s
+  encoding:     %s
+
+  columns:      %d
+  rows:         %d (%s)`,
+		source.Path, source.Format, source.Compression, source.Encoding,
+		len(ui.columns), ui.rowCount, status)
+
+	if len(ui.tables) > 1 {
+		text += fmt.Sprintf("\n  table:        %s (%d of %d)",
+			ui.tables[ui.tableIdx].Table, ui.tableIdx+1, len(ui.tables))
+	}
+
+	ui.pushHandler(NewPopup(ui, text))
+}
+
+// Most malformed lines to list, there's no point in scrolling through more
+const MaxProblemsShown = 1000
+
+func (ui *UI) pushProblemsPopup() {
+	problems := ui.rows.Problems()
+	if len(problems) == 0 {
+		ui.pushHandler(NewPopup(ui, "No malformed lines found."))
+		return
+	}
+
+	lines := []string{
+		"",
+		"  [ bad lines ]",
+		"  -------------",
+	}
+
+	for i, problem := range problems {
+		if i == MaxProblemsShown {
+			lines = append(lines, "", fmt.Sprintf("  ... and %d more", len(problems)-i))
+			break
+		}
+
+		lines = append(lines, "", fmt.Sprintf("  line %d: %s", problem.Line, problem.Reason))
+		if problem.Text != "" {
+			lines = append(lines, "    "+problem.Text)
+		}
+	}
+
+	ui.pushHandler(NewPopup(ui, strings.Join(lines, "\n")))
+}
+
 func (ui *UI) pushErrorPopup(msg string, err error) {
 	errMsg := fmt.Sprintf("Error: %s\n\n%v", msg, err)
 	ui.pushHandler(NewPopup(ui, errMsg))
 }
 
 func (ui *UI) getRow(idx int) []string {
-	row := make([]string, len(ui.columns))
+	if idx < 0 || idx >= ui.rows.Len() {
+		panic(fmt.Errorf("Overflowed row bounds: %d [0, %d]", idx, ui.rows.Len()))
+	}
+
+	return ui.displayRow(idx, ui.rows.Row(idx))
+}
+
+// Call fn with each row from start up to end, in order, as getRow would
+// return them. Stores which can read them all in one pass do.
+func (ui *UI) scanRows(start, end int, fn func(idx int, row []string)) {
+	scanner, ok := ui.rows.(rowScanner)
+	if !ok {
+		for i := start; i < end; i++ {
+			fn(i, ui.getRow(i))
+		}
 
-	if idx < 0 || idx >= len(ui.rows) {
-		panic(fmt.Errorf("Overflowed row bounds: %d [0, %d]", idx, len(ui.rows)))
+		return
 	}
 
-	origRow := ui.rows[idx]
+	scanner.ScanRows(start, end, func(idx int, row []string) {
+		fn(idx, ui.displayRow(idx, row))
+	})
+}
+
+// Apply any column modifications to a row from the store, and fill in
+// missing values.
+func (ui *UI) displayRow(idx int, origRow []string) []string {
+	row := make([]string, len(ui.columns))
 
 	for i, col := range ui.columns {
-		if col.Modified {
+		// Rows loaded after a column was modified keep their original values
+		if col.Modified && idx < len(col.ModifiedValues) {
 			row[i] = col.ModifiedValues[idx]
-		} else {
+		} else if i < len(origRow) {
 			row[i] = origRow[i]
+		} else {
+			row[i] = ui.null
 		}
 	}
 
@@ -0,0 +1,225 @@
+// Reading psql's expanded and MySQL's vertical output, which print each
+// record as a block with one line per field.
+
+package vxsv
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// Starts each record of psql's expanded output, e.g. -[ RECORD 1 ]---,
+	// or * Record 1 with \pset border 0
+	psqlRecordRegex = regexp.MustCompile(`^([+┌├]?[-─]\[ RECORD \d+ \]|\* Record \d+$)`)
+
+	// Starts each record of MySQL's \G output, e.g. *** 1. row ***
+	mysqlRecordRegex = regexp.MustCompile(`^\*+ \d+\. row \*+$`)
+
+	// Follows MySQL's output, e.g. 2 rows in set (0.00 sec)
+	mysqlFooterRegex = regexp.MustCompile(`^(\d+ rows? in set|Empty set)`)
+)
+
+// Lines between the names and values of psql's expanded output, in the ascii
+// and unicode line styles. The dashed ones are drawn beside values carrying
+// on from the line before.
+var psqlFieldDividers = []string{" | ", " │ ", " ╎ ", " ┊ "}
+
+// Parses psql's expanded output, as shown with \x:
+//
+//	-[ RECORD 1 ]----    * Record 1    ┌─[ RECORD 1 ]─┐
+//	id   | 1             id   1        │ id   │ 1     │
+//	name | foo           name foo      │ name │ foo   │
+//	-[ RECORD 2 ]----    * Record 2    ├─[ RECORD 2 ]─┤
+//	id   | 2             id   2        │ id   │ 2     │
+//	name | bar           name bar      │ name │ bar   │
+//	                                   └──────┴───────┘
+//
+// Each record becomes a row, with the field names as columns. The first
+// line, which starts the first record, has already been read.
+func streamPSQLExpanded(lines *lineScanner, count int64) (*sqlResult, error) {
+	// Border 0 pads the names without a line after them, so every value
+	// starts in the same column as the first field's does
+	unbordered := strings.HasPrefix(lines.text, "*")
+	valueWidth := -1
+
+	reader := &verticalReader{
+		lines:   lines,
+		isStart: psqlRecordRegex.MatchString,
+		isEnd: func(line string) bool {
+			return line == "" || psqlFooterRegex.MatchString(line) || isTableRule(line)
+		},
+		field: func(line string) (string, string) {
+			if unbordered {
+				if valueWidth == -1 {
+					name := line
+					if idx := strings.IndexByte(line, ' '); idx != -1 {
+						value := strings.TrimLeft(line[idx:], " ")
+						name = line[:len(line)-len(value)]
+					}
+
+					valueWidth = displayWidth(name)
+				}
+
+				name, value := splitAtWidth(line, valueWidth)
+				return strings.TrimSpace(name), strings.TrimRight(value, " ")
+			}
+
+			// Border 2 draws a box around each field
+			if border, size := utf8.DecodeRuneInString(line); strings.ContainsRune(psqlRowBorders, border) {
+				line = trimPSQLBorder(line[size:])
+			}
+
+			for _, divider := range psqlFieldDividers {
+				if idx := strings.Index(line, divider); idx != -1 {
+					return strings.TrimSpace(line[:idx]), strings.TrimRight(line[idx+len(divider):], " ")
+				}
+			}
+
+			return "", strings.TrimSpace(line)
+		},
+		join: func(value, more string) string {
+			// Markers are left on the end of each line but the last
+			trimmed := strings.TrimRight(value, " ")
+			marker, size := utf8.DecodeLastRuneInString(trimmed)
+
+			if strings.ContainsRune(psqlNewlineMarkers, marker) {
+				return strings.TrimRight(trimmed[:len(trimmed)-size], " ") + "\n" + more
+			} else if strings.ContainsRune(psqlWrapMarkers, marker) {
+				return trimmed[:len(trimmed)-size] + more
+			}
+
+			return value + "\n" + more
+		},
+	}
+
+	return reader.result(count)
+}
+
+// Split a line where it reaches width display columns.
+func splitAtWidth(line string, width int) (string, string) {
+	col := 0
+	for idx, r := range line {
+		if col >= width {
+			return line[:idx], line[idx:]
+		}
+
+		col += runeWidth(r)
+	}
+
+	return line, ""
+}
+
+// Parses MySQL's vertical output, as shown with \G:
+//
+//	*************************** 1. row ***************************
+//	  id: 1
+//	name: foo
+//	*************************** 2. row ***************************
+//	  id: 2
+//	name: bar
+//	2 rows in set (0.00 sec)
+//
+// Each record becomes a row, with the field names as columns. Values with
+// newlines in them carry on over the following lines. The first line, which
+// starts the first record, has already been read.
+func streamMySQLVertical(lines *lineScanner, count int64) (*sqlResult, error) {
+	// Names are lined up on the right, so every field's ": " is at the same
+	// width as the first one's
+	nameWidth := -1
+
+	reader := &verticalReader{
+		lines:   lines,
+		isStart: mysqlRecordRegex.MatchString,
+		isEnd:   mysqlFooterRegex.MatchString,
+		field: func(line string) (string, string) {
+			idx := strings.Index(line, ": ")
+			if idx == -1 {
+				return "", line
+			}
+
+			name := line[:idx]
+			if nameWidth == -1 {
+				nameWidth = displayWidth(name)
+			} else if displayWidth(name) != nameWidth {
+				return "", line
+			}
+
+			return strings.TrimSpace(name), line[idx+2:]
+		},
+		join: func(value, more string) string {
+			return value + "\n" + more
+		},
+	}
+
+	return reader.result(count)
+}
+
+// Reads records laid out one field per line, split up by a line starting
+// each record.
+type verticalReader struct {
+	lines   *lineScanner
+	isStart func(line string) bool
+	isEnd   func(line string) bool
+
+	// Name and value of a field, with an empty name for lines continuing
+	// the previous field's value
+	field func(line string) (string, string)
+	join  func(value, more string) string
+
+	done bool
+}
+
+func (r *verticalReader) result(count int64) (*sqlResult, error) {
+	// Fields missing from a record are left blank, like psql's nulls
+	data, next, err := jsonRecordRows(r.next, "", false, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlResult{data, func() {
+		data.Store.(*MemoryStore).load(next, count)
+
+		// Skip any records past the row limit
+		for !r.done {
+			r.next()
+		}
+	}}, nil
+}
+
+// The fields of the next record
+func (r *verticalReader) next() ([]jsonField, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+
+	var fields []jsonField
+
+	for r.lines.scan() {
+		line := strings.TrimRight(r.lines.text, "\r")
+
+		if r.isStart(line) {
+			return fields, nil
+		} else if r.isEnd(strings.TrimRight(line, " ")) {
+			break
+		}
+
+		name, value := r.field(line)
+		if name != "" {
+			fields = append(fields, jsonField{name: name, value: value})
+		} else if len(fields) > 0 {
+			last := &fields[len(fields)-1]
+			last.value = r.join(last.value, value)
+		}
+	}
+
+	r.done = true
+
+	if len(fields) == 0 {
+		return nil, scannerDone(r.lines.scanner)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,147 @@
+package vxsv
+
+import "testing"
+
+func TestReadPSQLExpanded(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []sqlTable
+	}{
+		{
+			name: "border 1",
+			input: `-[ RECORD 1 ]-----
+id   | 1
+name | foo
+txt  | a   +
+     |   b
+-[ RECORD 2 ]-----
+id   | 2
+name | x | y
+txt  | 
+`,
+			want: []sqlTable{{
+				[]string{"id", "name", "txt"},
+				[][]string{{"1", "foo", "a\n  b"}, {"2", "x | y", ""}},
+			}},
+		},
+		{
+			name: "differing fields",
+			input: `-[ RECORD 1 ]-
+id   | 1
+name | foo
+-[ RECORD 2 ]-
+id   | 2
+note | bar
+`,
+			want: []sqlTable{{
+				[]string{"id", "name", "note"},
+				[][]string{{"1", "foo", ""}, {"2", "", "bar"}},
+			}},
+		},
+		{
+			name:  "no records",
+			input: "(0 rows)\n",
+			want:  []sqlTable{{nil, nil}},
+		},
+	}
+
+	for _, test := range tests {
+		tables, _ := readSQLResults(t, readPSQL, test.input)
+		checkSQLTables(t, test.name, tables, test.want)
+	}
+}
+
+func TestReadMySQLVertical(t *testing.T) {
+	input := `*************************** 1. row ***************************
+  id: 1
+name: foo
+text: line one
+and two
+*************************** 2. row ***************************
+  id: 2
+name: bar
+text: NULL
+2 rows in set (0.00 sec)
+`
+
+	tables, _ := readSQLResults(t, readMySQL, input)
+	checkSQLTables(t, "mysql", tables, []sqlTable{{
+		[]string{"id", "name", "text"},
+		[][]string{{"1", "foo", "line one\nand two"}, {"2", "bar", "NULL"}},
+	}})
+}
+
+func TestReadPSQLExpandedStyles(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []sqlTable
+	}{
+		{
+			name: "border 0",
+			input: `* Record 1
+id   1
+name foo
+* Record 2
+id   2
+name 日本
+`,
+			want: []sqlTable{{
+				[]string{"id", "name"},
+				[][]string{{"1", "foo"}, {"2", "日本"}},
+			}},
+		},
+		{
+			name: "border 2",
+			input: `+-[ RECORD 1 ]-+-----+
+| id           | 1   |
+| name         | foo |
++-[ RECORD 2 ]-+-----+
+| id           | 2   |
+| name         | bar |
++--------------+-----+
+`,
+			want: []sqlTable{{
+				[]string{"id", "name"},
+				[][]string{{"1", "foo"}, {"2", "bar"}},
+			}},
+		},
+		{
+			name: "unicode",
+			input: `─[ RECORD 1 ]───
+id   │ 1
+name │ foo    ↵
+     ╎ bar
+─[ RECORD 2 ]───
+id   │ 2
+name │ wrapp…
+     ┊ ed
+`,
+			want: []sqlTable{{
+				[]string{"id", "name"},
+				[][]string{{"1", "foo\nbar"}, {"2", "wrapped"}},
+			}},
+		},
+		{
+			name: "unicode border 2",
+			input: `┌─[ RECORD 1 ]─┐
+│ id   │ 1     │
+│ name │ foo   │
+├─[ RECORD 2 ]─┤
+│ id   │ 2     │
+│ name │ bar   │
+└──────┴───────┘
+`,
+			want: []sqlTable{{
+				[]string{"id", "name"},
+				[][]string{{"1", "foo"}, {"2", "bar"}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		tables, _ := readSQLResults(t, readPSQL, test.input)
+		checkSQLTables(t, test.name, tables, test.want)
+	}
+}